@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"cortex-task/internal/config"
+	"cortex-task/internal/db"
+	"cortex-task/internal/migrate"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// news-migrate applies or lists schema migrations without starting the service.
+//
+//	news-migrate up      apply pending migrations
+//	news-migrate status  list migrations and when they were applied
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := log.New(os.Stdout, "[news-migrate] ", log.LstdFlags)
+
+	cmd := "up"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+
+	mongoClient, err := db.ConnectMongo(ctx, cfg.MongoURI)
+	if err != nil {
+		logger.Fatalf("failed to connect to db: %v", err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = mongoClient.Disconnect(shutdownCtx)
+	}()
+
+	migrator, err := migrate.New(mongoClient.Database(cfg.MongoDBName), migrate.Articles(), logger)
+	if err != nil {
+		logger.Fatalf("failed to init migrations: %v", err)
+	}
+
+	switch cmd {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			logger.Fatalf("migrate up failed: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Fatalf("migrate status failed: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = s.Applied.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-25s  %s\n", s.Version, applied, s.Description)
+		}
+	default:
+		logger.Fatalf("unknown command %q, expected up or status", cmd)
+	}
+}
@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"cortex-task/internal/api"
 	"cortex-task/internal/article"
 	"cortex-task/internal/config"
 	"cortex-task/internal/db"
 	"cortex-task/internal/event"
 	"cortex-task/internal/ingest"
+	"cortex-task/internal/migrate"
+	"cortex-task/internal/retention"
+	"cortex-task/internal/spool"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 )
@@ -29,19 +39,165 @@ func main() {
 		logger.Fatalf("failed to load config: %v", err)
 	}
 
-	// Mongo
-	mongoClient, err := db.ConnectMongo(ctx, cfg.MongoURI)
-	if err != nil {
-		logger.Fatalf("failed to connect to db: %v", err)
+	// Event sinks: RabbitMQ, signed webhooks and/or a local log file
+	format := event.MessageFormat{
+		Payload:  event.PayloadMode(cfg.EventPayload),
+		Versions: cfg.EventSchemaVersions,
+		Source:   cfg.CloudEventsSource,
 	}
-	dbInstance := mongoClient.Database(cfg.MongoDBName)
+	var (
+		sinks  []event.Sink
+		rabbit *event.RabbitPublisher // nil without the rabbitmq sink
+	)
+	for _, name := range cfg.EventPublishers {
+		sink := event.Sink{Name: name}
 
-	// Article repository
-	articleRepo, err := article.NewMongoArticleRepository(dbInstance, logger)
-	if err != nil {
-		logger.Fatalf("failed to init repository: %v", err)
+		switch name {
+		case config.PublisherRabbit:
+			rabbit, err = event.NewRabbitPublisher(
+				cfg.RabbitURI,
+				cfg.RabbitExchange,
+				cfg.RabbitRoutingKey,
+				cfg.RabbitRoutingTemplate,
+				format,
+				cfg.RabbitConfirmTimeout,
+				logger,
+			)
+			if err != nil {
+				logger.Fatalf("failed to init rabbit publisher: %v", err)
+			}
+			defer rabbit.Close()
+			sink.Publisher = rabbit
+
+			// Events the broker can't take are spooled to disk and published once it's back, with more than one
+			// sink the fan-out spools every event instead
+			if cfg.SpoolDir != "" && len(cfg.EventPublishers) == 1 {
+				eventSpool, err := spool.Open(cfg.SpoolDir, cfg.SpoolMaxBytes, spool.DefaultSegmentSize)
+				if err != nil {
+					logger.Fatalf("failed to open event spool: %v", err)
+				}
+				defer eventSpool.Close()
+
+				spooling := event.NewSpoolingPublisher(rabbit, eventSpool, logger)
+				go spooling.Run(ctx)
+				sink.Publisher = spooling
+			}
+
+		case config.PublisherWebhook:
+			// Rejected events of every endpoint go to the same file, each endpoint is a sink of its own
+			deadLetter, err := event.NewFilePublisher(cfg.WebhookDeadLetterPath, format)
+			if err != nil {
+				logger.Fatalf("failed to open webhook dead letter file: %v", err)
+			}
+			defer deadLetter.Close()
+
+			for _, w := range cfg.Webhooks {
+				endpoint := event.WebhookEndpoint{URL: w.URL, Secret: cfg.WebhookSecret, Timeout: w.Timeout}
+				name := webhookSinkName(w.URL)
+				sinks = append(sinks, event.Sink{Name: name, Publisher: event.NewWebhookPublisher(endpoint, format, deadLetter, logger)})
+				logger.Printf("events: webhook %s is sink %s", w.URL, name)
+			}
+			continue
+
+		case config.PublisherFile:
+			filePublisher, err := event.NewFilePublisher(cfg.EventLogPath, format)
+			if err != nil {
+				logger.Fatalf("failed to open event log: %v", err)
+			}
+			defer filePublisher.Close()
+			sink.Publisher = filePublisher
+		}
+		sinks = append(sinks, sink)
+	}
+
+	debounce := event.Debounce{Window: cfg.EventDebounceWindow, MaxDelay: cfg.EventDebounceMaxDelay}
+
+	// A single sink is published to directly, several get a spool each so one can't hold up the others
+	var (
+		events event.Publisher = sinks[0].Publisher
+		fanout *event.FanoutPublisher
+	)
+	if len(sinks) > 1 {
+		for i := range sinks {
+			sinkSpool, err := spool.Open(filepath.Join(cfg.SpoolDir, sinks[i].Name), cfg.SpoolMaxBytes, spool.DefaultSegmentSize)
+			if err != nil {
+				logger.Fatalf("failed to open spool of sink %s: %v", sinks[i].Name, err)
+			}
+			defer sinkSpool.Close()
+			sinks[i].Spool = sinkSpool
+		}
+		fanout = event.NewFanoutPublisher(sinks, logger)
+		go fanout.Run(ctx)
+		events = fanout
+	}
+
+	// Storage, the event source depends on the backend: Mongo change streams or the embedded change feed
+	var (
+		articleRepo   article.Repository
+		quarantine    article.Quarantine
+		eventsService interface{ Run(ctx context.Context) }
+		retentionJob  *retention.Job // mongo only
+		closeStorage  func(ctx context.Context) error
+	)
+
+	switch cfg.StorageBackend {
+	case config.StorageBolt:
+		boltRepo, err := article.NewBoltArticleRepository(cfg.BoltPath, logger)
+		if err != nil {
+			logger.Fatalf("failed to init embedded repository: %v", err)
+		}
+		articleRepo, quarantine = boltRepo, boltRepo
+		eventsService = event.NewFeedService(boltRepo, debounce, events, logger)
+		closeStorage = func(context.Context) error { return boltRepo.Close() }
+
+	default:
+		mongoClient, err := db.ConnectMongo(ctx, cfg.MongoURI)
+		if err != nil {
+			logger.Fatalf("failed to connect to db: %v", err)
+		}
+		dbInstance := mongoClient.Database(cfg.MongoDBName)
+
+		if cfg.MigrateOnStart {
+			migrator, err := migrate.New(dbInstance, migrate.Articles(), logger)
+			if err != nil {
+				logger.Fatalf("failed to init migrations: %v", err)
+			}
+			if err := migrator.Up(ctx); err != nil {
+				logger.Fatalf("failed to apply migrations: %v", err)
+			}
+		}
+
+		if cfg.EventSource == config.EventSourceOutbox {
+			articleRepo, err = article.NewMongoOutboxArticleRepository(dbInstance, logger)
+			eventsService = event.NewOutboxRelay(dbInstance, events, cfg.OutboxPollInterval, logger)
+		} else {
+			articleRepo, err = article.NewMongoArticleRepository(dbInstance, logger)
+			eventsService = event.NewService(
+				dbInstance.Collection("articles"),
+				event.NewMongoCheckpointStore(dbInstance, "articles"),
+				options.FullDocument(cfg.ChangeStreamFullDocument),
+				cfg.EventWorkers,
+				debounce,
+				events,
+				logger,
+			)
+		}
+		if err != nil {
+			logger.Fatalf("failed to init repository: %v", err)
+		}
+		quarantine = article.NewMongoQuarantine(dbInstance, logger)
+		retentionJob, err = retention.NewJob(dbInstance, retention.Policy{
+			MaxAge:    cfg.RetentionMaxAge,
+			Field:     cfg.RetentionField,
+			Mode:      cfg.RetentionMode,
+			BatchSize: cfg.RetentionBatchSize,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("failed to init retention: %v", err)
+		}
+		closeStorage = mongoClient.Disconnect
 	}
-	logger.Println("article repository initialised")
+	logger.Printf("article repository initialised (%s)", cfg.StorageBackend)
 
 	// Feed client
 	httpClient := &http.Client{Timeout: cfg.Timeout}
@@ -50,6 +206,7 @@ func main() {
 	// Ingest service (poller)
 	ingestService := ingest.NewService(
 		articleRepo,
+		quarantine,
 		feedClient,
 		cfg.PageSize,
 		cfg.MaxPages,
@@ -57,30 +214,15 @@ func main() {
 		logger,
 	)
 
-	// Event publisher (RabbitMQ)
-	publisher, err := event.NewRabbitPublisher(
-		cfg.RabbitURI,
-		cfg.RabbitExchange,
-		cfg.RabbitRoutingKey,
-		logger,
-	)
-	if err != nil {
-		logger.Fatalf("failed to init rabbit publisher: %v", err)
-	}
-	defer publisher.Close()
-
-	eventsService := event.NewService(
-		dbInstance.Collection("articles"),
-		publisher,
-		logger,
-	)
-
-	// HTTP health server
-	srv := healthz(logger)
+	// HTTP server (health + article API)
+	srv := httpServer(logger, api.NewHandler(articleRepo, logger), rabbit, fanout)
 
 	// Start background workers
 	go ingestService.StartPolling(ctx, cfg.PollInterval)
 	go eventsService.Run(ctx)
+	if retentionJob != nil {
+		go retentionJob.Start(ctx, cfg.RetentionInterval)
+	}
 
 	logger.Println("service started")
 
@@ -97,15 +239,20 @@ func main() {
 		logger.Printf("HTTP server shutdown error: %v", err)
 	}
 
-	// Graceful Mongo shutdown
-	if err := mongoClient.Disconnect(shutdownCtx); err != nil {
-		logger.Printf("mongo disconnect error: %v", err)
+	// Graceful storage shutdown
+	if err := closeStorage(shutdownCtx); err != nil {
+		logger.Printf("storage shutdown error: %v", err)
 	}
 
 	logger.Println("shutdown complete")
 }
 
-func healthz(logger *log.Logger) *http.Server {
+func httpServer(
+	logger *log.Logger,
+	apiHandler *api.Handler,
+	rabbit *event.RabbitPublisher,
+	fanout *event.FanoutPublisher,
+) *http.Server {
 	r := mux.NewRouter()
 
 	r.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
@@ -113,6 +260,35 @@ func healthz(logger *log.Logger) *http.Server {
 		_, _ = w.Write([]byte("ok"))
 	}).Methods(http.MethodGet)
 
+	// events wait while RabbitMQ is reconnecting, report it here rather than on /healthz so the instance is
+	// taken out of rotation instead of restarted, the publisher reconnects on its own
+	r.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if rabbit != nil {
+			if state := rabbit.State(); state != event.StateConnected {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("rabbitmq " + string(state)))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}).Methods(http.MethodGet)
+
+	// health of every event sink when there's more than one
+	r.HandleFunc("/healthz/sinks", func(w http.ResponseWriter, _ *http.Request) {
+		health := []event.SinkHealth{}
+		if fanout != nil {
+			health = fanout.Health()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(health)
+	}).Methods(http.MethodGet)
+
+	// expvar metrics, events_spool has the depth of the event spool
+	r.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+
+	apiHandler.Register(r)
+
 	srv := &http.Server{
 		Addr:    ":8080",
 		Handler: r,
@@ -127,3 +303,10 @@ func healthz(logger *log.Logger) *http.Server {
 
 	return srv
 }
+
+// webhookSinkName names the sink of a webhook endpoint after its URL, so it keeps its spool when WEBHOOK_URLS is
+// reordered.
+func webhookSinkName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "webhook-" + hex.EncodeToString(sum[:4])
+}
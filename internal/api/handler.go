@@ -0,0 +1,166 @@
+package api
+
+import (
+	"cortex-task/internal/article"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler exposes read-only article endpoints over HTTP.
+type Handler struct {
+	repo   article.Repository
+	logger *log.Logger
+}
+
+func NewHandler(repo article.Repository, logger *log.Logger) *Handler {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &Handler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Register mounts the article routes on r.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/articles/search", h.search).Methods(http.MethodGet)
+	r.HandleFunc("/articles/{externalId:[0-9]+}", h.getArticle).Methods(http.MethodGet)
+	r.HandleFunc("/articles/{externalId:[0-9]+}/revisions", h.listRevisions).Methods(http.MethodGet)
+	r.HandleFunc("/articles/{externalId:[0-9]+}/revisions/{revision:[0-9]+}", h.getRevision).Methods(http.MethodGet)
+}
+
+// getArticle returns the current state of an article, it's what consumers of delta and reference events fetch.
+func (h *Handler) getArticle(w http.ResponseWriter, r *http.Request) {
+	externalID, err := strconv.ParseInt(mux.Vars(r)["externalId"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid externalId")
+		return
+	}
+
+	a, err := h.repo.GetByExternalID(r.Context(), externalID)
+	if errors.Is(err, article.ErrNotFound) {
+		h.writeError(w, http.StatusNotFound, "article not found")
+		return
+	}
+	if err != nil {
+		h.logger.Printf("api: failed fetching article %d: %v", externalID, err)
+		h.writeError(w, http.StatusInternalServerError, "failed to fetch article")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) listRevisions(w http.ResponseWriter, r *http.Request) {
+	externalID, err := strconv.ParseInt(mux.Vars(r)["externalId"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid externalId")
+		return
+	}
+
+	revisions, err := h.repo.ListRevisions(r.Context(), externalID)
+	if err != nil {
+		h.logger.Printf("api: failed listing revisions for %d: %v", externalID, err)
+		h.writeError(w, http.StatusInternalServerError, "failed to list revisions")
+		return
+	}
+	if len(revisions) == 0 {
+		h.writeError(w, http.StatusNotFound, "article not found")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, revisions)
+}
+
+func (h *Handler) getRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	externalID, err := strconv.ParseInt(vars["externalId"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid externalId")
+		return
+	}
+	revision, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	rev, err := h.repo.GetRevision(r.Context(), externalID, revision)
+	if errors.Is(err, article.ErrNotFound) {
+		h.writeError(w, http.StatusNotFound, "revision not found")
+		return
+	}
+	if err != nil {
+		h.logger.Printf("api: failed fetching revision %d of %d: %v", revision, externalID, err)
+		h.writeError(w, http.StatusInternalServerError, "failed to fetch revision")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, rev)
+}
+
+// search handles GET /articles/search?q=...&type=&language=&from=&to=&limit=, from and to are RFC3339 and
+// bound the article date.
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := article.SearchQuery{
+		Text: params.Get("q"),
+		Filter: article.Filter{
+			Type:     params.Get("type"),
+			Language: params.Get("language"),
+		},
+	}
+
+	var err error
+	if v := params.Get("from"); v != "" {
+		if q.DateFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid from, expected RFC3339")
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.DateTo, err = time.Parse(time.RFC3339, v); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid to, expected RFC3339")
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			h.writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	hits, err := h.repo.Search(r.Context(), q)
+	if errors.Is(err, article.ErrEmptySearch) {
+		h.writeError(w, http.StatusBadRequest, "missing search terms")
+		return
+	}
+	if err != nil {
+		h.logger.Printf("api: search for %q failed: %v", q.Text, err)
+		h.writeError(w, http.StatusInternalServerError, "search failed")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, hits)
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Printf("api: failed writing response: %v", err)
+	}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, status int, msg string) {
+	h.writeJSON(w, status, map[string]string{"error": msg})
+}
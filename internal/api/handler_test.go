@@ -0,0 +1,165 @@
+package api
+
+import (
+	"cortex-task/internal/article"
+	"cortex-task/internal/article/articletest"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+// -------------------------
+// Suite
+// -------------------------
+
+type HandlerSuite struct {
+	suite.Suite
+
+	repo   *articletest.Repository
+	router *mux.Router
+}
+
+func TestHandlerSuite(t *testing.T) {
+	suite.Run(t, new(HandlerSuite))
+}
+
+func (s *HandlerSuite) SetupTest() {
+	s.repo = &articletest.Repository{}
+	s.router = mux.NewRouter()
+	NewHandler(s.repo, log.New(io.Discard, "", 0)).Register(s.router)
+}
+
+func (s *HandlerSuite) do(path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// -------------------------
+// Tests
+// -------------------------
+
+func (s *HandlerSuite) TestListRevisions() {
+	s.repo.
+		On("ListRevisions", mock.Anything, int64(1001)).
+		Return([]article.Revision{
+			{ExternalID: 1001, Revision: 1, Article: article.Article{Title: "First"}},
+			{ExternalID: 1001, Revision: 2, Article: article.Article{Title: "Second"}},
+		}, nil).
+		Once()
+
+	rec := s.do("/articles/1001/revisions")
+
+	s.Equal(http.StatusOK, rec.Code)
+	var got []article.Revision
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &got))
+	s.Len(got, 2)
+	s.Equal("Second", got[1].Article.Title)
+	s.Contains(rec.Body.String(), `"article":{"id":"000000000000000000000000","externalId":0,"type":"","title":"First"`)
+	s.repo.AssertExpectations(s.T())
+}
+
+func (s *HandlerSuite) TestListRevisions_UnknownArticle() {
+	s.repo.On("ListRevisions", mock.Anything, int64(42)).Return([]article.Revision{}, nil).Once()
+
+	rec := s.do("/articles/42/revisions")
+
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+func (s *HandlerSuite) TestGetRevision() {
+	s.repo.
+		On("GetRevision", mock.Anything, int64(1001), 2).
+		Return(&article.Revision{ExternalID: 1001, Revision: 2, RunID: "run-1"}, nil).
+		Once()
+
+	rec := s.do("/articles/1001/revisions/2")
+
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"runId":"run-1"`)
+}
+
+func (s *HandlerSuite) TestGetRevision_NotFound() {
+	s.repo.On("GetRevision", mock.Anything, int64(1001), 9).Return(nil, article.ErrNotFound).Once()
+
+	rec := s.do("/articles/1001/revisions/9")
+
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+func (s *HandlerSuite) TestGetRevision_RepoError() {
+	s.repo.On("GetRevision", mock.Anything, int64(1001), 1).Return(nil, errors.New("db down")).Once()
+
+	rec := s.do("/articles/1001/revisions/1")
+
+	s.Equal(http.StatusInternalServerError, rec.Code)
+}
+
+func (s *HandlerSuite) TestSearch() {
+	want := article.SearchQuery{
+		Text:   "wicket drama",
+		Filter: article.Filter{Language: "en", DateFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Limit:  5,
+	}
+	s.repo.
+		On("Search", mock.Anything, want).
+		Return([]article.SearchHit{{Article: &article.Article{ExternalID: 7, Title: "Wicket drama"}, Score: 2.5}}, nil).
+		Once()
+
+	rec := s.do("/articles/search?q=wicket+drama&language=en&from=2024-01-01T00:00:00Z&limit=5")
+
+	s.Equal(http.StatusOK, rec.Code)
+	var got []article.SearchHit
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &got))
+	s.Require().Len(got, 1)
+	s.Equal(int64(7), got[0].Article.ExternalID)
+	s.Equal(2.5, got[0].Score)
+	s.repo.AssertExpectations(s.T())
+}
+
+func (s *HandlerSuite) TestSearch_EmptyQuery() {
+	s.repo.On("Search", mock.Anything, mock.Anything).Return(nil, article.ErrEmptySearch).Once()
+
+	rec := s.do("/articles/search?q=")
+
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func (s *HandlerSuite) TestSearch_InvalidDate() {
+	rec := s.do("/articles/search?q=wicket&from=yesterday")
+
+	s.Equal(http.StatusBadRequest, rec.Code)
+	s.repo.AssertNotCalled(s.T(), "Search", mock.Anything, mock.Anything)
+}
+
+func (s *HandlerSuite) TestGetArticle() {
+	s.repo.
+		On("GetByExternalID", mock.Anything, int64(1001)).
+		Return(&article.Article{ExternalID: 1001, Title: "Current", Revision: 3}, nil).
+		Once()
+
+	rec := s.do("/articles/1001")
+
+	s.Equal(http.StatusOK, rec.Code)
+	var got article.Article
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &got))
+	s.Equal("Current", got.Title)
+	s.Equal(3, got.Revision)
+}
+
+func (s *HandlerSuite) TestGetArticle_NotFound() {
+	s.repo.On("GetByExternalID", mock.Anything, int64(42)).Return(nil, article.ErrNotFound).Once()
+
+	rec := s.do("/articles/42")
+
+	s.Equal(http.StatusNotFound, rec.Code)
+}
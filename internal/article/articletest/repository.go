@@ -0,0 +1,61 @@
+// Package articletest has test doubles for the article package, shared by the tests of the packages using it.
+package articletest
+
+import (
+	"context"
+	"cortex-task/internal/article"
+
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var _ article.Repository = (*Repository)(nil)
+
+// Repository is a testify mock of article.Repository. Pointer results may be returned as nil.
+type Repository struct {
+	mock.Mock
+}
+
+func (m *Repository) BulkUpsert(ctx context.Context, articles []*article.Article) (article.UpsertResult, error) {
+	args := m.Called(ctx, articles)
+	return args.Get(0).(article.UpsertResult), args.Error(1)
+}
+
+func (m *Repository) GetByExternalID(ctx context.Context, externalID int64) (*article.Article, error) {
+	args := m.Called(ctx, externalID)
+	a, _ := args.Get(0).(*article.Article)
+	return a, args.Error(1)
+}
+
+func (m *Repository) GetByID(ctx context.Context, id primitive.ObjectID) (*article.Article, error) {
+	args := m.Called(ctx, id)
+	a, _ := args.Get(0).(*article.Article)
+	return a, args.Error(1)
+}
+
+func (m *Repository) List(ctx context.Context, q article.ListQuery) (article.ListPage, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).(article.ListPage), args.Error(1)
+}
+
+func (m *Repository) Count(ctx context.Context, f article.Filter) (int64, error) {
+	args := m.Called(ctx, f)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *Repository) Search(ctx context.Context, q article.SearchQuery) ([]article.SearchHit, error) {
+	args := m.Called(ctx, q)
+	hits, _ := args.Get(0).([]article.SearchHit)
+	return hits, args.Error(1)
+}
+
+func (m *Repository) ListRevisions(ctx context.Context, externalID int64) ([]article.Revision, error) {
+	args := m.Called(ctx, externalID)
+	return args.Get(0).([]article.Revision), args.Error(1)
+}
+
+func (m *Repository) GetRevision(ctx context.Context, externalID int64, revision int) (*article.Revision, error) {
+	args := m.Called(ctx, externalID, revision)
+	rev, _ := args.Get(0).(*article.Revision)
+	return rev, args.Error(1)
+}
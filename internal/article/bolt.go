@@ -0,0 +1,578 @@
+package article
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxChangeLog is how many changes the embedded store keeps for its change feed. Only changes at or before
+// the saved position are trimmed, ones that haven't been published yet are kept however many there are.
+const maxChangeLog = 10000
+
+var (
+	bucketArticles       = []byte("articles")                 // externalId -> article
+	bucketByID           = []byte("articles_by_id")           // _id -> externalId
+	bucketByLastModified = []byte("articles_by_lastModified") // lastModified + _id -> externalId
+	bucketRevisions      = []byte("article_revisions")        // externalId + revision -> revision
+	bucketChanges        = []byte("article_changes")          // seq -> change
+	bucketQuarantine     = []byte("articles_quarantine")      // seq -> quarantined article
+	bucketFeedPosition   = []byte("change_feed_position")     // feedPositionKey -> seq of the last published change
+)
+
+var feedPositionKey = []byte("events")
+
+// EmbeddedRepository is a Repository stored in a local file. There's no change stream to watch so it
+// publishes its own change feed, written in the same transaction as the articles.
+type EmbeddedRepository interface {
+	Repository
+	Quarantine
+	ChangeFeed
+	Close() error
+}
+
+// boltRepository keeps articles in a bbolt file, values are bson encoded with the same tags as Mongo and
+// the externalId and lastModified indexes are kept as separate buckets with sortable keys.
+type boltRepository struct {
+	db     *bolt.DB
+	logger *log.Logger
+
+	mu     sync.Mutex
+	notify chan struct{} // closed and replaced after every committed change
+}
+
+func NewBoltArticleRepository(path string, logger *log.Logger) (EmbeddedRepository, error) {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open embedded store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{
+			bucketArticles, bucketByID, bucketByLastModified, bucketRevisions, bucketChanges, bucketQuarantine, bucketFeedPosition,
+		}
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create embedded store buckets: %w", err)
+	}
+
+	return &boltRepository{
+		db:     db,
+		logger: logger,
+		notify: make(chan struct{}),
+	}, nil
+}
+
+func (r *boltRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *boltRepository) BulkUpsert(ctx context.Context, articles []*Article) (UpsertResult, error) {
+	var result UpsertResult
+	if len(articles) == 0 {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	runID := RunIDFromContext(ctx)
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for _, a := range articles {
+			ex, err := getArticle(tx, a.ExternalID)
+			if err != nil {
+				return err
+			}
+
+			var (
+				next    Article
+				op      ChangeOp
+				changes []FieldChange
+			)
+
+			if ex == nil {
+				a.CreatedAt = now
+				a.ModifiedAt = now
+				a.Revision = 1
+				next = *copyArticle(a)
+				next.ID = primitive.NewObjectID()
+				op = ChangeInsert
+			} else {
+				shouldUpdateArticle, shouldUpdateMedia := freshParts(ex, a)
+				if !shouldUpdateArticle && !shouldUpdateMedia {
+					result.Stale = append(result.Stale, a.ExternalID)
+					continue
+				}
+
+				changes = diffArticle(ex, a, shouldUpdateArticle, shouldUpdateMedia)
+				next = mergeArticle(*ex, a, shouldUpdateArticle, shouldUpdateMedia)
+				next.ModifiedAt = now
+				next.Revision = ex.Revision + 1
+				next.LastChanges = changes
+				op = ChangeUpdate
+			}
+
+			if err := putArticle(tx, ex, &next); err != nil {
+				return err
+			}
+			if err := putBSON(tx.Bucket(bucketRevisions), revisionKey(next.ExternalID, next.Revision), Revision{
+				ID:         primitive.NewObjectID(),
+				ExternalID: next.ExternalID,
+				Revision:   next.Revision,
+				Timestamp:  now,
+				RunID:      runID,
+				Changes:    changes,
+				Article:    next,
+			}); err != nil {
+				return err
+			}
+			if err := appendChange(tx, Change{
+				Op:         op,
+				DocumentID: next.ID,
+				ExternalID: next.ExternalID,
+				Time:       now,
+				Changes:    changes,
+				Article:    next,
+			}); err != nil {
+				return err
+			}
+
+			if op == ChangeInsert {
+				result.Inserted = append(result.Inserted, a.ExternalID)
+			} else {
+				result.Updated = append(result.Updated, a.ExternalID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return UpsertResult{}, err
+	}
+
+	if result.Changed() > 0 {
+		r.broadcast()
+	}
+	return result, nil
+}
+
+// broadcast wakes up every change feed subscriber.
+func (r *boltRepository) broadcast() {
+	r.mu.Lock()
+	close(r.notify)
+	r.notify = make(chan struct{})
+	r.mu.Unlock()
+}
+
+func (r *boltRepository) GetByExternalID(_ context.Context, externalID int64) (*Article, error) {
+	var a *Article
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		a, err = getArticle(tx, externalID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrNotFound
+	}
+	return a, nil
+}
+
+func (r *boltRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	var externalID []byte
+	_ = r.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketByID).Get(id[:]); v != nil {
+			externalID = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if externalID == nil {
+		return nil, ErrNotFound
+	}
+	return r.GetByExternalID(ctx, decodeSortable(externalID))
+}
+
+// List walks the externalId or lastModified index in order and applies the filter as it goes.
+func (r *boltRepository) List(_ context.Context, q ListQuery) (ListPage, error) {
+	var page ListPage
+
+	q, err := q.normalise()
+	if err != nil {
+		return page, err
+	}
+
+	var seek []byte
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return page, err
+		}
+		seek = sortable(c.value)
+		if q.SortBy == SortByLastModified {
+			seek = append(seek, c.id[:]...)
+		}
+	}
+
+	page.Articles = make([]*Article, 0, q.Limit)
+	err = r.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(bucketArticles)
+		if q.SortBy == SortByLastModified {
+			index = tx.Bucket(bucketByLastModified)
+		}
+
+		c := index.Cursor()
+		for k, v := startIndex(c, seek, q.Descending); k != nil; k, v = stepIndex(c, q.Descending) {
+			a := &Article{}
+			if q.SortBy == SortByLastModified {
+				var err error
+				if a, err = getArticle(tx, decodeSortable(v)); err != nil {
+					return err
+				}
+			} else if err := bson.Unmarshal(v, a); err != nil {
+				return err
+			}
+
+			if a == nil || !matchesFilter(a, q.Filter) {
+				continue
+			}
+			if len(page.Articles) == q.Limit {
+				page.NextCursor = cursorFor(page.Articles[q.Limit-1], q.SortBy).encode()
+				return nil
+			}
+			page.Articles = append(page.Articles, a)
+		}
+		return nil
+	})
+	return page, err
+}
+
+// startIndex positions c on the first key of the page, skipping the key the cursor points at.
+func startIndex(c *bolt.Cursor, seek []byte, descending bool) ([]byte, []byte) {
+	if seek == nil {
+		if descending {
+			return c.Last()
+		}
+		return c.First()
+	}
+
+	k, v := c.Seek(seek)
+	if descending {
+		if k == nil {
+			k, v = c.Last()
+		}
+		for k != nil && bytes.Compare(k, seek) >= 0 {
+			k, v = c.Prev()
+		}
+		return k, v
+	}
+	for k != nil && bytes.Equal(k, seek) {
+		k, v = c.Next()
+	}
+	return k, v
+}
+
+func stepIndex(c *bolt.Cursor, descending bool) ([]byte, []byte) {
+	if descending {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+func (r *boltRepository) Count(_ context.Context, f Filter) (int64, error) {
+	var n int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketArticles).ForEach(func(_, v []byte) error {
+			var a Article
+			if err := bson.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			if matchesFilter(&a, f) {
+				n++
+			}
+			return nil
+		})
+	})
+	return n, err
+}
+
+// Search scans every article, there's no text index in the embedded store.
+func (r *boltRepository) Search(_ context.Context, q SearchQuery) ([]SearchHit, error) {
+	q, err := q.normalise()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*Article, 0)
+	err = r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketArticles).ForEach(func(_, v []byte) error {
+			a := &Article{}
+			if err := bson.Unmarshal(v, a); err != nil {
+				return err
+			}
+			candidates = append(candidates, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return searchArticles(candidates, q), nil
+}
+
+func (r *boltRepository) ListRevisions(_ context.Context, externalID int64) ([]Revision, error) {
+	revisions := make([]Revision, 0)
+	prefix := sortable(externalID)
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketRevisions).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rev Revision
+			if err := bson.Unmarshal(v, &rev); err != nil {
+				return err
+			}
+			revisions = append(revisions, rev)
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+func (r *boltRepository) GetRevision(_ context.Context, externalID int64, revision int) (*Revision, error) {
+	var rev *Revision
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketRevisions).Get(revisionKey(externalID, revision))
+		if v == nil {
+			return nil
+		}
+		rev = &Revision{}
+		return bson.Unmarshal(v, rev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rev == nil {
+		return nil, ErrNotFound
+	}
+	return rev, nil
+}
+
+func (r *boltRepository) Quarantine(ctx context.Context, a *Article, reason string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketQuarantine)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putBSON(b, sortable(int64(seq)), QuarantinedArticle{
+			ID:         primitive.NewObjectID(),
+			ExternalID: a.ExternalID,
+			Reason:     reason,
+			RunID:      RunIDFromContext(ctx),
+			FailedAt:   time.Now(),
+			Article:    *a,
+		})
+	})
+}
+
+func (r *boltRepository) LastSeq() (uint64, error) {
+	var seq uint64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(bucketChanges).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+func (r *boltRepository) Position() (uint64, bool, error) {
+	var (
+		seq uint64
+		ok  bool
+	)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketFeedPosition).Get(feedPositionKey); v != nil {
+			seq, ok = uint64(decodeSortable(v)), true
+		}
+		return nil
+	})
+	return seq, ok, err
+}
+
+func (r *boltRepository) SavePosition(seq uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFeedPosition).Put(feedPositionKey, sortable(int64(seq)))
+	})
+}
+
+func (r *boltRepository) Subscribe(ctx context.Context, after uint64) <-chan Change {
+	out := make(chan Change)
+
+	go func() {
+		defer close(out)
+
+		for {
+			// take the notify channel before reading so a commit in between still wakes us up
+			r.mu.Lock()
+			notify := r.notify
+			r.mu.Unlock()
+
+			changes, err := r.changesAfter(after, 100)
+			if err != nil {
+				r.logger.Printf("change feed: failed reading changes after %d: %v", after, err)
+			}
+
+			if len(changes) > 0 && changes[0].Seq > after+1 {
+				r.logger.Printf("change feed: WARNING changes %d to %d were trimmed from the log before being read, they're skipped",
+					after+1, changes[0].Seq-1)
+			}
+			for _, c := range changes {
+				select {
+				case out <- c:
+					after = c.Seq
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(changes) == 100 {
+				continue // there may be more waiting
+			}
+
+			select {
+			case <-notify:
+			case <-time.After(time.Second): // also recover from read errors
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (r *boltRepository) changesAfter(after uint64, limit int) ([]Change, error) {
+	changes := make([]Change, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketChanges).Cursor()
+		for k, v := c.Seek(sortable(int64(after + 1))); k != nil && len(changes) < limit; k, v = c.Next() {
+			var change Change
+			if err := bson.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	return changes, err
+}
+
+func getArticle(tx *bolt.Tx, externalID int64) (*Article, error) {
+	v := tx.Bucket(bucketArticles).Get(sortable(externalID))
+	if v == nil {
+		return nil, nil
+	}
+	var a Article
+	if err := bson.Unmarshal(v, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// putArticle stores next and moves its lastModified index entry from the previous version ex, if any.
+func putArticle(tx *bolt.Tx, ex, next *Article) error {
+	if err := putBSON(tx.Bucket(bucketArticles), sortable(next.ExternalID), next); err != nil {
+		return err
+	}
+
+	externalID := sortable(next.ExternalID)
+	if err := tx.Bucket(bucketByID).Put(next.ID[:], externalID); err != nil {
+		return err
+	}
+
+	byLastModified := tx.Bucket(bucketByLastModified)
+	if ex != nil {
+		if err := byLastModified.Delete(lastModifiedKey(ex)); err != nil {
+			return err
+		}
+	}
+	return byLastModified.Put(lastModifiedKey(next), externalID)
+}
+
+// appendChange adds c to the change log and trims it to maxChangeLog entries, without going past the saved
+// feed position.
+func appendChange(tx *bolt.Tx, c Change) error {
+	b := tx.Bucket(bucketChanges)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	c.Seq = seq
+	if err := putBSON(b, sortable(int64(seq)), c); err != nil {
+		return err
+	}
+
+	if seq <= maxChangeLog {
+		return nil
+	}
+	position := tx.Bucket(bucketFeedPosition).Get(feedPositionKey)
+	if position == nil {
+		return nil // nothing published yet
+	}
+	oldest := sortable(int64(min(seq-maxChangeLog, uint64(decodeSortable(position)))))
+	cur := b.Cursor()
+	for k, _ := cur.First(); k != nil && bytes.Compare(k, oldest) <= 0; k, _ = cur.First() {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putBSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// lastModifiedKey is truncated to milliseconds, the precision bson stores times at, so the key written for
+// an article can be rebuilt from the decoded copy when it needs deleting.
+func lastModifiedKey(a *Article) []byte {
+	return append(sortable(a.LastModified.Truncate(time.Millisecond).UnixNano()), a.ID[:]...)
+}
+
+func revisionKey(externalID int64, revision int) []byte {
+	return append(sortable(externalID), sortable(int64(revision))...)
+}
+
+// sortable encodes n so that bytewise key order matches numeric order, negatives included.
+func sortable(n int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n)^(1<<63))
+	return b
+}
+
+func decodeSortable(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+}
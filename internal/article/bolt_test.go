@@ -0,0 +1,128 @@
+package article_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cortex-task/internal/article"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextChange(t *testing.T, ch <-chan article.Change) article.Change {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change")
+		return article.Change{}
+	}
+}
+
+func TestBoltChangeFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo, err := article.NewBoltArticleRepository(filepath.Join(t.TempDir(), "news.db"), nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.BulkUpsert(ctx, []*article.Article{fixture(1, 1700000000, 1700000000)})
+	require.NoError(t, err)
+
+	// replay from the start
+	feed := repo.Subscribe(ctx, 0)
+	insert := nextChange(t, feed)
+	assert.Equal(t, uint64(1), insert.Seq)
+	assert.Equal(t, article.ChangeInsert, insert.Op)
+	assert.Equal(t, int64(1), insert.ExternalID)
+	assert.False(t, insert.DocumentID.IsZero())
+
+	// live changes are delivered as they are committed
+	in := fixture(1, 1700000500, 1700000000)
+	in.Title = "Updated"
+	_, err = repo.BulkUpsert(ctx, []*article.Article{in})
+	require.NoError(t, err)
+
+	update := nextChange(t, feed)
+	assert.Equal(t, uint64(2), update.Seq)
+	assert.Equal(t, article.ChangeUpdate, update.Op)
+	assert.Equal(t, "Updated", update.Article.Title)
+	assert.True(t, update.Article.Changed("title"))
+
+	// stale writes don't produce a change
+	_, err = repo.BulkUpsert(ctx, []*article.Article{in})
+	require.NoError(t, err)
+	last, err := repo.LastSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), last)
+
+	cancel()
+	for range feed {
+		// drain until closed
+	}
+}
+
+func TestBoltPersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "news.db")
+	ctx := context.Background()
+
+	repo, err := article.NewBoltArticleRepository(path, nil)
+	require.NoError(t, err)
+	_, err = repo.BulkUpsert(ctx, []*article.Article{fixture(7, 1700000000, 1700000000)})
+	require.NoError(t, err)
+	_, ok, err := repo.Position()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, repo.SavePosition(1))
+	require.NoError(t, repo.Close())
+
+	repo, err = article.NewBoltArticleRepository(path, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	got, err := repo.GetByExternalID(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "Title", got.Title)
+
+	last, err := repo.LastSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), last)
+
+	position, ok, err := repo.Position()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), position)
+}
+
+func TestBoltKeepsUnpublishedChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo, err := article.NewBoltArticleRepository(filepath.Join(t.TempDir(), "news.db"), nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	// more changes than the log keeps, none of them published
+	articles := make([]*article.Article, 0, 10005)
+	for id := range int64(10005) {
+		articles = append(articles, fixture(id+1, 1700000000, 1700000000))
+	}
+	_, err = repo.BulkUpsert(ctx, articles)
+	require.NoError(t, err)
+
+	first := nextChange(t, repo.Subscribe(ctx, 0))
+	assert.Equal(t, uint64(1), first.Seq, "nothing is trimmed before it's published")
+
+	// trimmed up to the saved position, not to the newest 10000
+	require.NoError(t, repo.SavePosition(3))
+	_, err = repo.BulkUpsert(ctx, []*article.Article{fixture(20000, 1700000000, 1700000000)})
+	require.NoError(t, err)
+
+	first = nextChange(t, repo.Subscribe(ctx, 0))
+	assert.Equal(t, uint64(4), first.Seq, "only the published changes 1 to 3 are gone")
+}
@@ -0,0 +1,39 @@
+package article
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+)
+
+// Change is a single write recorded by a repository that has no Mongo change stream to watch. Seq increases
+// by one for every change so it doubles as a position to resume the feed from.
+type Change struct {
+	Seq        uint64             `bson:"seq"`
+	Op         ChangeOp           `bson:"op"`
+	DocumentID primitive.ObjectID `bson:"documentId"`
+	ExternalID int64              `bson:"externalId"`
+	Time       time.Time          `bson:"time"`
+	Changes    []FieldChange      `bson:"changes,omitempty"`
+	Article    Article            `bson:"article"` // state of the article right after the change
+}
+
+// ChangeFeed streams the changes written to a repository in order.
+type ChangeFeed interface {
+	// Subscribe delivers every change with a Seq greater than after, the channel is closed once ctx is done.
+	Subscribe(ctx context.Context, after uint64) <-chan Change
+	// LastSeq returns the Seq of the newest change, subscribing after it only delivers new changes.
+	LastSeq() (uint64, error)
+	// Position returns the Seq saved with SavePosition, ok is false until the first save.
+	Position() (seq uint64, ok bool, err error)
+	// SavePosition records that every change up to seq has been published, so a restart resumes after it.
+	SavePosition(seq uint64) error
+}
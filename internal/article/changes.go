@@ -0,0 +1,84 @@
+package article
+
+import (
+	"slices"
+	"time"
+)
+
+// FieldChange describes a single field that was modified by an update. Field is the bson path of the
+// value (e.g. `title` or `leadMedia.imageUrl`) so consumers can match on the same names stored in Mongo.
+type FieldChange struct {
+	Field string `bson:"field" json:"field"`
+	Old   any    `bson:"old" json:"old"`
+	New   any    `bson:"new" json:"new"`
+}
+
+// freshParts applies the update rules shared by every Repository: the article fields are only replaced when
+// the incoming lastModified is newer than the stored one, and the lead media only when its own lastModified is.
+func freshParts(ex, a *Article) (article, media bool) {
+	article = !a.LastModified.IsZero() && a.LastModified.After(ex.LastModified)
+	media = !a.LeadMedia.LastModified.IsZero() && a.LeadMedia.LastModified.After(ex.LeadMedia.LastModified)
+	return article, media
+}
+
+// diffArticle compares the stored article with the incoming one and returns every field that differs.
+// article and media control which halves of the document are compared, mirroring the lastModified rules
+// in BulkUpsert so we never report a change for data we are not going to write.
+func diffArticle(ex, a *Article, article, media bool) []FieldChange {
+	var changes []FieldChange
+
+	addString := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	addInt := func(field string, old, new int64) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	addTime := func(field string, old, new time.Time) {
+		if !old.Equal(new) {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+
+	if article {
+		addString("type", ex.Type, a.Type)
+		addString("title", ex.Title, a.Title)
+		addString("description", ex.Description, a.Description)
+		addTime("date", ex.Date, a.Date)
+		addString("location", ex.Location, a.Location)
+		addString("language", ex.Language, a.Language)
+		addString("canonicalUrl", ex.CanonicalURL, a.CanonicalURL)
+		addTime("lastModified", ex.LastModified, a.LastModified)
+		addString("body", ex.Body, a.Body)
+		addString("summary", ex.Summary, a.Summary)
+		if !slices.Equal(ex.Tags, a.Tags) {
+			changes = append(changes, FieldChange{Field: "tags", Old: ex.Tags, New: a.Tags})
+		}
+	}
+
+	if media {
+		addInt("leadMedia.id", ex.LeadMedia.ID, a.LeadMedia.ID)
+		addString("leadMedia.type", ex.LeadMedia.Type, a.LeadMedia.Type)
+		addString("leadMedia.title", ex.LeadMedia.Title, a.LeadMedia.Title)
+		addTime("leadMedia.date", ex.LeadMedia.Date, a.LeadMedia.Date)
+		addString("leadMedia.language", ex.LeadMedia.Language, a.LeadMedia.Language)
+		addString("leadMedia.imageUrl", ex.LeadMedia.ImageURL, a.LeadMedia.ImageURL)
+		addTime("leadMedia.lastModified", ex.LeadMedia.LastModified, a.LeadMedia.LastModified)
+	}
+
+	return changes
+}
+
+// Changed reports whether the last update to the article touched the given field. A parent path such as
+// `leadMedia` matches any of its children.
+func (a *Article) Changed(field string) bool {
+	for _, c := range a.LastChanges {
+		if c.Field == field || (len(c.Field) > len(field) && c.Field[:len(field)] == field && c.Field[len(field)] == '.') {
+			return true
+		}
+	}
+	return false
+}
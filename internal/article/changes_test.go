@@ -0,0 +1,59 @@
+package article
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffArticle_OnlyReportsChangedFields(t *testing.T) {
+	ex := &Article{
+		Title:        "Old Title",
+		Body:         "same",
+		LastModified: time.Unix(1700000000, 0),
+		LeadMedia: LeadMedia{
+			ImageURL:     "https://img/old.jpg",
+			LastModified: time.Unix(1700000000, 0),
+		},
+	}
+	in := &Article{
+		Title:        "New Title",
+		Body:         "same",
+		LastModified: time.Unix(1700000500, 0),
+		LeadMedia: LeadMedia{
+			ImageURL:     "https://img/new.jpg",
+			LastModified: time.Unix(1700000500, 0),
+		},
+	}
+
+	changes := diffArticle(ex, in, true, false)
+
+	assert.Equal(t, []FieldChange{
+		{Field: "title", Old: "Old Title", New: "New Title"},
+		{Field: "lastModified", Old: time.Unix(1700000000, 0), New: time.Unix(1700000500, 0)},
+	}, changes)
+}
+
+func TestDiffArticle_LeadMedia(t *testing.T) {
+	ex := &Article{LeadMedia: LeadMedia{ImageURL: "https://img/old.jpg", LastModified: time.Unix(1, 0)}}
+	in := &Article{Title: "ignored", LeadMedia: LeadMedia{ImageURL: "https://img/new.jpg", LastModified: time.Unix(2, 0)}}
+
+	changes := diffArticle(ex, in, false, true)
+
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "leadMedia.imageUrl", changes[0].Field)
+	assert.Equal(t, "https://img/old.jpg", changes[0].Old)
+	assert.Equal(t, "https://img/new.jpg", changes[0].New)
+	assert.Equal(t, "leadMedia.lastModified", changes[1].Field)
+}
+
+func TestArticleChanged(t *testing.T) {
+	a := &Article{LastChanges: []FieldChange{{Field: "leadMedia.imageUrl"}, {Field: "title"}}}
+
+	assert.True(t, a.Changed("title"))
+	assert.True(t, a.Changed("leadMedia.imageUrl"))
+	assert.True(t, a.Changed("leadMedia"))
+	assert.False(t, a.Changed("lead"))
+	assert.False(t, a.Changed("body"))
+}
@@ -0,0 +1,314 @@
+package article_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cortex-task/internal/article"
+	"cortex-task/internal/db"
+
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RepositoryContractSuite is run against every article.Repository implementation so they all apply the
+// same update rules. newRepo must return an empty repository.
+type RepositoryContractSuite struct {
+	suite.Suite
+
+	ctx     context.Context
+	newRepo func() article.Repository
+	repo    article.Repository
+}
+
+func (s *RepositoryContractSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.repo = s.newRepo()
+}
+
+func TestMemoryRepositoryContract(t *testing.T) {
+	suite.Run(t, &RepositoryContractSuite{
+		newRepo: article.NewMemoryArticleRepository,
+	})
+}
+
+func TestBoltRepositoryContract(t *testing.T) {
+	suite.Run(t, &RepositoryContractSuite{
+		newRepo: func() article.Repository {
+			repo, err := article.NewBoltArticleRepository(filepath.Join(t.TempDir(), "news.db"), nil)
+			if err != nil {
+				t.Fatalf("failed to create bolt repository: %v", err)
+			}
+			t.Cleanup(func() { _ = repo.Close() })
+			return repo
+		},
+	})
+}
+
+func TestMongoRepositoryContract(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := db.ConnectMongo(ctx, "mongodb://localhost:27017")
+	if err != nil {
+		t.Skipf("mongo contract tests need MongoDB at localhost:27017: %v", err)
+	}
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	database := client.Database("test_newsdb_contract")
+
+	suite.Run(t, &RepositoryContractSuite{
+		newRepo: func() article.Repository {
+			return newMongoRepo(t, database)
+		},
+	})
+}
+
+func newMongoRepo(t *testing.T, database *mongo.Database) article.Repository {
+	if err := database.Drop(context.Background()); err != nil {
+		t.Fatalf("failed to drop test db: %v", err)
+	}
+	repo, err := article.NewMongoArticleRepository(database, nil)
+	if err != nil {
+		t.Fatalf("failed to create article repository: %v", err)
+	}
+	return repo
+}
+
+func fixture(externalID int64, lastModified, mediaModified int64) *article.Article {
+	return &article.Article{
+		ExternalID:   externalID,
+		Type:         "text",
+		Title:        "Title",
+		Language:     "en",
+		Date:         time.Unix(lastModified, 0).UTC(),
+		LastModified: time.Unix(lastModified, 0).UTC(),
+		LeadMedia: article.LeadMedia{
+			ID:           externalID * 10,
+			Title:        "Lead",
+			ImageURL:     "https://img/lead.jpg",
+			LastModified: time.Unix(mediaModified, 0).UTC(),
+		},
+	}
+}
+
+func (s *RepositoryContractSuite) upsert(articles ...*article.Article) article.UpsertResult {
+	res, err := s.repo.BulkUpsert(s.ctx, articles)
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *RepositoryContractSuite) get(externalID int64) *article.Article {
+	a, err := s.repo.GetByExternalID(s.ctx, externalID)
+	s.Require().NoError(err)
+	return a
+}
+
+func (s *RepositoryContractSuite) TestInsert() {
+	res := s.upsert(fixture(1, 1700000000, 1700000000), fixture(2, 1700000000, 1700000000))
+
+	s.ElementsMatch([]int64{1, 2}, res.Inserted)
+	s.Equal(2, res.Changed())
+
+	got := s.get(1)
+	s.Equal("Title", got.Title)
+	s.Equal(1, got.Revision)
+	s.False(got.ID.IsZero())
+	s.True(got.LastModified.Equal(time.Unix(1700000000, 0)))
+
+	byID, err := s.repo.GetByID(s.ctx, got.ID)
+	s.Require().NoError(err)
+	s.Equal(int64(1), byID.ExternalID)
+}
+
+func (s *RepositoryContractSuite) TestNotFound() {
+	_, err := s.repo.GetByExternalID(s.ctx, 404)
+	s.ErrorIs(err, article.ErrNotFound)
+
+	_, err = s.repo.GetRevision(s.ctx, 404, 1)
+	s.ErrorIs(err, article.ErrNotFound)
+}
+
+func (s *RepositoryContractSuite) TestOlderOrEqualIsStale() {
+	s.upsert(fixture(1, 1700000500, 1700000500))
+
+	older := fixture(1, 1700000000, 1700000000)
+	older.Title = "Older"
+	same := fixture(1, 1700000500, 1700000500)
+	same.Title = "Same"
+
+	res := s.upsert(older)
+	s.Equal([]int64{1}, res.Stale)
+	res = s.upsert(same)
+	s.Equal([]int64{1}, res.Stale)
+
+	s.Equal("Title", s.get(1).Title)
+}
+
+func (s *RepositoryContractSuite) TestNewerArticleKeepsLeadMedia() {
+	s.upsert(fixture(1, 1700000000, 1700000000))
+
+	in := fixture(1, 1700000500, 1700000000)
+	in.Title = "Updated Title"
+	in.LeadMedia.Title = "Ignored, media not newer"
+
+	res := s.upsert(in)
+	s.Equal([]int64{1}, res.Updated)
+
+	got := s.get(1)
+	s.Equal("Updated Title", got.Title)
+	s.Equal("Lead", got.LeadMedia.Title)
+	s.Equal(2, got.Revision)
+	s.True(got.Changed("title"))
+	s.True(got.Changed("lastModified"))
+	s.False(got.Changed("leadMedia"))
+}
+
+func (s *RepositoryContractSuite) TestNewerLeadMediaKeepsArticle() {
+	s.upsert(fixture(1, 1700000000, 1700000000))
+
+	in := fixture(1, 1700000000, 1700000900)
+	in.Title = "Ignored, article not newer"
+	in.LeadMedia.ImageURL = "https://img/new.jpg"
+
+	res := s.upsert(in)
+	s.Equal([]int64{1}, res.Updated)
+
+	got := s.get(1)
+	s.Equal("Title", got.Title)
+	s.Equal("https://img/new.jpg", got.LeadMedia.ImageURL)
+	s.True(got.Changed("leadMedia.imageUrl"))
+	s.False(got.Changed("title"))
+}
+
+func (s *RepositoryContractSuite) TestRevisions() {
+	s.upsert(fixture(1, 1700000000, 1700000000))
+
+	in := fixture(1, 1700000500, 1700000000)
+	in.Title = "Second"
+	_, err := s.repo.BulkUpsert(article.WithRunID(s.ctx, "run-2"), []*article.Article{in})
+	s.Require().NoError(err)
+
+	revisions, err := s.repo.ListRevisions(s.ctx, 1)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 2)
+	s.Equal(1, revisions[0].Revision)
+	s.Equal("Title", revisions[0].Article.Title)
+	s.Equal(2, revisions[1].Revision)
+	s.Equal("Second", revisions[1].Article.Title)
+	s.Equal("run-2", revisions[1].RunID)
+
+	rev, err := s.repo.GetRevision(s.ctx, 1, 2)
+	s.Require().NoError(err)
+	s.Equal("Second", rev.Article.Title)
+	s.Equal("title", rev.Changes[0].Field)
+}
+
+func (s *RepositoryContractSuite) TestListPagesWithoutGapsOrOverlap() {
+	// two articles share a lastModified so the _id tie break is exercised
+	s.upsert(
+		fixture(1, 1700000100, 0),
+		fixture(2, 1700000200, 0),
+		fixture(3, 1700000200, 0),
+		fixture(4, 1700000300, 0),
+		fixture(5, 1700000400, 0),
+	)
+
+	for _, descending := range []bool{false, true} {
+		var seen []int64
+		cursor := ""
+		for {
+			page, err := s.repo.List(s.ctx, article.ListQuery{Limit: 2, Cursor: cursor, Descending: descending})
+			s.Require().NoError(err)
+			for _, a := range page.Articles {
+				seen = append(seen, a.ExternalID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		s.Len(seen, 5)
+		s.ElementsMatch([]int64{1, 2, 3, 4, 5}, seen)
+		if descending {
+			s.Equal(int64(5), seen[0])
+		} else {
+			s.Equal(int64(1), seen[0])
+		}
+	}
+}
+
+func (s *RepositoryContractSuite) TestListFiltersAndCount() {
+	video := fixture(2, 1700000200, 0)
+	video.Type = "video"
+	french := fixture(3, 1700000300, 0)
+	french.Language = "fr"
+	s.upsert(fixture(1, 1700000100, 0), video, french)
+
+	page, err := s.repo.List(s.ctx, article.ListQuery{
+		Filter: article.Filter{Type: "text", Language: "en"},
+		SortBy: article.SortByExternalID,
+	})
+	s.Require().NoError(err)
+	s.Require().Len(page.Articles, 1)
+	s.Equal(int64(1), page.Articles[0].ExternalID)
+
+	count, err := s.repo.Count(s.ctx, article.Filter{ModifiedSince: time.Unix(1700000200, 0)})
+	s.Require().NoError(err)
+	s.Equal(int64(2), count)
+
+	count, err = s.repo.Count(s.ctx, article.Filter{DateFrom: time.Unix(1700000100, 0), DateTo: time.Unix(1700000300, 0)})
+	s.Require().NoError(err)
+	s.Equal(int64(2), count)
+
+	_, err = s.repo.List(s.ctx, article.ListQuery{Cursor: "garbage"})
+	s.ErrorIs(err, article.ErrInvalidCursor)
+}
+
+func (s *RepositoryContractSuite) TestConcurrentWritersKeepNewest() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			_, err := s.repo.BulkUpsert(s.ctx, []*article.Article{fixture(1, 1700000000+i, 1700000000+i)})
+			s.NoError(err)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	got := s.get(1)
+	s.True(got.LastModified.Equal(time.Unix(1700000009, 0)))
+	s.True(got.LeadMedia.LastModified.Equal(time.Unix(1700000009, 0)))
+
+	count, err := s.repo.Count(s.ctx, article.Filter{})
+	s.Require().NoError(err)
+	s.Equal(int64(1), count)
+}
+
+func (s *RepositoryContractSuite) TestSearchRanksTitleMatchesFirst() {
+	inBody := fixture(1, 1700000100, 0)
+	inBody.Title = "Weekend review"
+	inBody.Body = "A late wicket swung the match"
+	inTitle := fixture(2, 1700000200, 0)
+	inTitle.Title = "Wicket drama at Lord's"
+	unrelated := fixture(3, 1700000300, 0)
+	unrelated.Title = "Ticket news"
+	french := fixture(4, 1700000400, 0)
+	french.Title = "Wicket en France"
+	french.Language = "fr"
+	s.upsert(inBody, inTitle, unrelated, french)
+
+	hits, err := s.repo.Search(s.ctx, article.SearchQuery{Text: "wicket", Filter: article.Filter{Language: "en"}})
+	s.Require().NoError(err)
+	s.Require().Len(hits, 2)
+	s.Equal(int64(2), hits[0].Article.ExternalID)
+	s.Equal(int64(1), hits[1].Article.ExternalID)
+	s.Greater(hits[0].Score, hits[1].Score)
+
+	_, err = s.repo.Search(s.ctx, article.SearchQuery{Text: "  "})
+	s.ErrorIs(err, article.ErrEmptySearch)
+}
@@ -0,0 +1,257 @@
+package article
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryRepository is a Repository kept entirely in memory. It applies the same lastModified and leadMedia
+// rules as mongoRepository, which is checked by the shared contract tests, so it can stand in for Mongo in
+// tests and local runs. Articles are copied on the way in and out so callers can't mutate stored state.
+type memoryRepository struct {
+	mu         sync.RWMutex
+	byExternal map[int64]*Article
+	byID       map[primitive.ObjectID]int64
+	revisions  map[int64][]Revision
+}
+
+func NewMemoryArticleRepository() Repository {
+	return &memoryRepository{
+		byExternal: make(map[int64]*Article),
+		byID:       make(map[primitive.ObjectID]int64),
+		revisions:  make(map[int64][]Revision),
+	}
+}
+
+func (r *memoryRepository) BulkUpsert(ctx context.Context, articles []*Article) (UpsertResult, error) {
+	var result UpsertResult
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	runID := RunIDFromContext(ctx)
+
+	for _, a := range articles {
+		ex, found := r.byExternal[a.ExternalID]
+		if !found {
+			a.CreatedAt = now
+			a.ModifiedAt = now
+			a.Revision = 1
+
+			stored := copyArticle(a)
+			stored.ID = primitive.NewObjectID()
+			r.byExternal[a.ExternalID] = stored
+			r.byID[stored.ID] = a.ExternalID
+			r.addRevision(Revision{
+				ExternalID: a.ExternalID,
+				Revision:   stored.Revision,
+				Timestamp:  now,
+				RunID:      runID,
+				Article:    *copyArticle(stored),
+			})
+			result.Inserted = append(result.Inserted, a.ExternalID)
+			continue
+		}
+
+		shouldUpdateArticle, shouldUpdateMedia := freshParts(ex, a)
+		if !shouldUpdateArticle && !shouldUpdateMedia {
+			result.Stale = append(result.Stale, a.ExternalID)
+			continue
+		}
+
+		changes := diffArticle(ex, a, shouldUpdateArticle, shouldUpdateMedia)
+		next := mergeArticle(*ex, a, shouldUpdateArticle, shouldUpdateMedia)
+		next.ModifiedAt = now
+		next.Revision = ex.Revision + 1
+		next.LastChanges = changes
+
+		r.byExternal[a.ExternalID] = &next
+		r.addRevision(Revision{
+			ExternalID: a.ExternalID,
+			Revision:   next.Revision,
+			Timestamp:  now,
+			RunID:      runID,
+			Changes:    changes,
+			Article:    *copyArticle(&next),
+		})
+		result.Updated = append(result.Updated, a.ExternalID)
+	}
+
+	return result, nil
+}
+
+func (r *memoryRepository) addRevision(rev Revision) {
+	rev.ID = primitive.NewObjectID()
+	r.revisions[rev.ExternalID] = append(r.revisions[rev.ExternalID], rev)
+}
+
+func (r *memoryRepository) GetByExternalID(_ context.Context, externalID int64) (*Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.byExternal[externalID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyArticle(a), nil
+}
+
+func (r *memoryRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	r.mu.RLock()
+	externalID, ok := r.byID[id]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.GetByExternalID(ctx, externalID)
+}
+
+func (r *memoryRepository) List(_ context.Context, q ListQuery) (ListPage, error) {
+	var page ListPage
+
+	q, err := q.normalise()
+	if err != nil {
+		return page, err
+	}
+
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return page, err
+		}
+		after = &c
+	}
+
+	r.mu.RLock()
+	matches := make([]*Article, 0, len(r.byExternal))
+	for _, a := range r.byExternal {
+		if !matchesFilter(a, q.Filter) {
+			continue
+		}
+		if after != nil && compareCursor(cursorFor(a, q.SortBy), *after, q.Descending) <= 0 {
+			continue
+		}
+		matches = append(matches, copyArticle(a))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return compareCursor(cursorFor(matches[i], q.SortBy), cursorFor(matches[j], q.SortBy), q.Descending) < 0
+	})
+
+	if len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+		page.NextCursor = cursorFor(matches[q.Limit-1], q.SortBy).encode()
+	}
+	page.Articles = matches
+	return page, nil
+}
+
+func (r *memoryRepository) Count(_ context.Context, f Filter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	for _, a := range r.byExternal {
+		if matchesFilter(a, f) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memoryRepository) Search(_ context.Context, q SearchQuery) ([]SearchHit, error) {
+	q, err := q.normalise()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	candidates := make([]*Article, 0, len(r.byExternal))
+	for _, a := range r.byExternal {
+		candidates = append(candidates, copyArticle(a))
+	}
+	r.mu.RUnlock()
+
+	return searchArticles(candidates, q), nil
+}
+
+func (r *memoryRepository) ListRevisions(_ context.Context, externalID int64) ([]Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := make([]Revision, len(r.revisions[externalID]))
+	copy(revisions, r.revisions[externalID])
+	return revisions, nil
+}
+
+func (r *memoryRepository) GetRevision(_ context.Context, externalID int64, revision int) (*Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rev := range r.revisions[externalID] {
+		if rev.Revision == revision {
+			return &rev, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// matchesFilter is the in-memory equivalent of filterDoc.
+func matchesFilter(a *Article, f Filter) bool {
+	if f.Type != "" && a.Type != f.Type {
+		return false
+	}
+	if f.Language != "" && a.Language != f.Language {
+		return false
+	}
+	if !f.DateFrom.IsZero() && a.Date.Before(f.DateFrom) {
+		return false
+	}
+	if !f.DateTo.IsZero() && !a.Date.Before(f.DateTo) {
+		return false
+	}
+	if !f.ModifiedSince.IsZero() && a.LastModified.Before(f.ModifiedSince) {
+		return false
+	}
+	return true
+}
+
+// compareCursor orders two positions the same way List sorts in Mongo, by value then _id.
+func compareCursor(a, b cursor, descending bool) int {
+	c := 0
+	switch {
+	case a.value < b.value:
+		c = -1
+	case a.value > b.value:
+		c = 1
+	default:
+		c = bytes.Compare(a.id[:], b.id[:])
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+func copyArticle(a *Article) *Article {
+	c := *a
+	c.Tags = slices.Clone(a.Tags)
+	if a.LastChanges != nil {
+		c.LastChanges = make([]FieldChange, len(a.LastChanges))
+		copy(c.LastChanges, a.LastChanges)
+	}
+	return &c
+}
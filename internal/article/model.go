@@ -6,29 +6,32 @@ import (
 )
 
 type Article struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	ExternalID   int64              `bson:"externalId"`
-	Type         string             `bson:"type"`
-	Title        string             `bson:"title"`
-	Description  string             `bson:"description"`
-	Date         time.Time          `bson:"date"`
-	Location     string             `bson:"location"`
-	Language     string             `bson:"language"`
-	CanonicalURL string             `bson:"canonicalUrl"`
-	LastModified time.Time          `bson:"lastModified"`
-	Body         string             `bson:"body"`
-	Summary      string             `bson:"summary"`
-	LeadMedia    LeadMedia          `bson:"leadMedia"`
-	CreatedAt    time.Time          `bson:"createdAt"`
-	ModifiedAt   time.Time          `bson:"modifiedAt"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ExternalID   int64              `bson:"externalId" json:"externalId"`
+	Type         string             `bson:"type" json:"type"`
+	Title        string             `bson:"title" json:"title"`
+	Description  string             `bson:"description" json:"description"`
+	Date         time.Time          `bson:"date" json:"date"`
+	Location     string             `bson:"location" json:"location"`
+	Language     string             `bson:"language" json:"language"`
+	CanonicalURL string             `bson:"canonicalUrl" json:"canonicalUrl"`
+	LastModified time.Time          `bson:"lastModified" json:"lastModified"`
+	Body         string             `bson:"body" json:"body"`
+	Summary      string             `bson:"summary" json:"summary"`
+	Tags         []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	LeadMedia    LeadMedia          `bson:"leadMedia" json:"leadMedia"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	ModifiedAt   time.Time          `bson:"modifiedAt" json:"modifiedAt"`
+	Revision     int                `bson:"revision" json:"revision"`
+	LastChanges  []FieldChange      `bson:"lastChanges,omitempty" json:"lastChanges,omitempty"`
 }
 
 type LeadMedia struct {
-	ID           int64     `bson:"id"`
-	Type         string    `bson:"type"`
-	Title        string    `bson:"title"`
-	Date         time.Time `bson:"date"`
-	Language     string    `bson:"language"`
-	ImageURL     string    `bson:"imageUrl"`
-	LastModified time.Time `bson:"lastModified"`
+	ID           int64     `bson:"id" json:"id"`
+	Type         string    `bson:"type" json:"type"`
+	Title        string    `bson:"title" json:"title"`
+	Date         time.Time `bson:"date" json:"date"`
+	Language     string    `bson:"language" json:"language"`
+	ImageURL     string    `bson:"imageUrl" json:"imageUrl"`
+	LastModified time.Time `bson:"lastModified" json:"lastModified"`
 }
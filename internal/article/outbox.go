@@ -0,0 +1,52 @@
+package article
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const OutboxCollection = "articles_outbox"
+
+// Outbox record statuses.
+const (
+	OutboxPending    = "pending"
+	OutboxPublishing = "publishing" // claimed by the relay named in Owner until LeaseUntil
+	OutboxDone       = "done"
+	OutboxFailed     = "failed" // gave up after too many attempts, left for someone to look at
+)
+
+// OutboxRecord is written in the same transaction as the article change it describes, so an event is never
+// lost or published for a write that didn't commit. It carries the article as written so the relay
+// publishes without reading the articles collection.
+type OutboxRecord struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	ExternalID    int64              `bson:"externalId"`
+	Revision      int                `bson:"revision"`
+	Op            ChangeOp           `bson:"op"`
+	RunID         string             `bson:"runId,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt"`
+	Changes       []FieldChange      `bson:"changes,omitempty"`
+	Article       Article            `bson:"article"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt"`
+	LastError     string             `bson:"lastError,omitempty"`
+	Owner         string             `bson:"owner,omitempty"`
+	LeaseUntil    time.Time          `bson:"leaseUntil,omitempty"`
+	PublishedAt   *time.Time         `bson:"publishedAt,omitempty"`
+}
+
+func newOutboxRecord(op ChangeOp, rev Revision) OutboxRecord {
+	return OutboxRecord{
+		ExternalID:    rev.ExternalID,
+		Revision:      rev.Revision,
+		Op:            op,
+		RunID:         rev.RunID,
+		CreatedAt:     rev.Timestamp,
+		Changes:       rev.Changes,
+		Article:       rev.Article,
+		Status:        OutboxPending,
+		NextAttemptAt: rev.Timestamp,
+	}
+}
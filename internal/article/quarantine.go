@@ -0,0 +1,52 @@
+package article
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// QuarantinedArticle is an article that kept failing to write, parked with the reason so it can be inspected
+// and replayed by hand.
+type QuarantinedArticle struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ExternalID int64              `bson:"externalId"`
+	Reason     string             `bson:"reason"`
+	RunID      string             `bson:"runId,omitempty"`
+	FailedAt   time.Time          `bson:"failedAt"`
+	Article    Article            `bson:"article"`
+}
+
+type Quarantine interface {
+	Quarantine(ctx context.Context, a *Article, reason string) error
+}
+
+type mongoQuarantine struct {
+	col    *mongo.Collection
+	logger *log.Logger
+}
+
+func NewMongoQuarantine(db *mongo.Database, logger *log.Logger) Quarantine {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &mongoQuarantine{
+		col:    db.Collection("articles_quarantine"),
+		logger: logger,
+	}
+}
+
+func (q *mongoQuarantine) Quarantine(ctx context.Context, a *Article, reason string) error {
+	_, err := q.col.InsertOne(ctx, QuarantinedArticle{
+		ExternalID: a.ExternalID,
+		Reason:     reason,
+		RunID:      RunIDFromContext(ctx),
+		FailedAt:   time.Now(),
+		Article:    *a,
+	})
+	return err
+}
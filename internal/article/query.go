@@ -0,0 +1,112 @@
+package article
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrInvalidCursor is returned by List when the cursor wasn't produced by a previous List call.
+var ErrInvalidCursor = errors.New("article: invalid cursor")
+
+// SortField is a field List can order by, only indexed fields are allowed so paging stays cheap.
+type SortField string
+
+const (
+	SortByLastModified SortField = "lastModified"
+	SortByExternalID   SortField = "externalId"
+)
+
+// Filter narrows the articles returned by List and Count, zero values are ignored.
+type Filter struct {
+	Type          string
+	Language      string
+	DateFrom      time.Time // date >= DateFrom
+	DateTo        time.Time // date < DateTo
+	ModifiedSince time.Time // lastModified >= ModifiedSince
+}
+
+type ListQuery struct {
+	Filter
+	SortBy     SortField // defaults to SortByLastModified
+	Descending bool
+	Limit      int    // defaults to DefaultListLimit, capped at MaxListLimit
+	Cursor     string // NextCursor from the previous page, empty for the first page
+}
+
+type ListPage struct {
+	Articles   []*Article
+	NextCursor string // empty when there are no more results
+}
+
+// normalise fills in the defaults for a query.
+func (q ListQuery) normalise() (ListQuery, error) {
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByLastModified
+	case SortByLastModified, SortByExternalID:
+	default:
+		return q, fmt.Errorf("article: unsupported sort field %q", q.SortBy)
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Limit > MaxListLimit {
+		q.Limit = MaxListLimit
+	}
+	return q, nil
+}
+
+// cursor is the position after the last article of a page, the value of the sort field plus _id to break
+// ties. both sort fields are encoded as int64 (lastModified as unix nanos) so the cursor is a plain string.
+type cursor struct {
+	value int64
+	id    primitive.ObjectID
+}
+
+func cursorFor(a *Article, sortBy SortField) cursor {
+	c := cursor{id: a.ID}
+	switch sortBy {
+	case SortByExternalID:
+		c.value = a.ExternalID
+	default:
+		c.value = a.LastModified.UnixNano()
+	}
+	return c
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.value, 10) + ":" + c.id.Hex()))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	value, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if c.value, err = strconv.ParseInt(value, 10, 64); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if c.id, err = primitive.ObjectIDFromHex(id); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,72 @@
+package article
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	a := &Article{
+		ID:           primitive.NewObjectID(),
+		ExternalID:   1001,
+		LastModified: time.UnixMilli(1764580500123),
+	}
+
+	for _, sortBy := range []SortField{SortByLastModified, SortByExternalID} {
+		c := cursorFor(a, sortBy)
+
+		got, err := decodeCursor(c.encode())
+		require.NoError(t, err)
+		assert.Equal(t, c, got)
+	}
+
+	assert.Equal(t, a.LastModified.UnixNano(), cursorFor(a, SortByLastModified).value)
+	assert.Equal(t, int64(1001), cursorFor(a, SortByExternalID).value)
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, in := range []string{"not base64!", "bm9jb2xvbg", "YWJjOjEyMw"} {
+		_, err := decodeCursor(in)
+		assert.ErrorIs(t, err, ErrInvalidCursor, in)
+	}
+}
+
+func TestListQueryNormalise(t *testing.T) {
+	q, err := ListQuery{}.normalise()
+	require.NoError(t, err)
+	assert.Equal(t, SortByLastModified, q.SortBy)
+	assert.Equal(t, DefaultListLimit, q.Limit)
+
+	q, err = ListQuery{Limit: 10000}.normalise()
+	require.NoError(t, err)
+	assert.Equal(t, MaxListLimit, q.Limit)
+
+	_, err = ListQuery{SortBy: "title"}.normalise()
+	assert.Error(t, err)
+}
+
+func TestFilterDoc(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	to := time.Unix(1700086400, 0)
+
+	doc := filterDoc(Filter{
+		Type:          "text",
+		Language:      "en",
+		DateFrom:      from,
+		DateTo:        to,
+		ModifiedSince: from,
+	})
+
+	assert.Equal(t, bson.M{
+		"type":         "text",
+		"language":     "en",
+		"date":         bson.M{"$gte": from, "$lt": to},
+		"lastModified": bson.M{"$gte": from},
+	}, doc)
+	assert.Empty(t, filterDoc(Filter{}))
+}
@@ -2,29 +2,49 @@ package article
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotFound is returned by lookups when no matching document exists.
+var ErrNotFound = errors.New("article: not found")
+
 type Repository interface {
-	BulkUpsert(ctx context.Context, articles []*Article) (int, error)
+	BulkUpsert(ctx context.Context, articles []*Article) (UpsertResult, error)
+	GetByExternalID(ctx context.Context, externalID int64) (*Article, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Article, error)
+	List(ctx context.Context, q ListQuery) (ListPage, error)
+	Count(ctx context.Context, f Filter) (int64, error)
+	Search(ctx context.Context, q SearchQuery) ([]SearchHit, error)
+	ListRevisions(ctx context.Context, externalID int64) ([]Revision, error)
+	GetRevision(ctx context.Context, externalID int64, revision int) (*Revision, error)
 }
 
 type mongoRepository struct {
-	col    *mongo.Collection
-	logger *log.Logger
+	col       *mongo.Collection
+	revisions *mongo.Collection
+	outbox    *mongo.Collection // nil unless writes go through the outbox
+	swept     *mongo.Collection
+	logger    *log.Logger
 }
 
 func NewMongoArticleRepository(db *mongo.Database, logger *log.Logger) (Repository, error) {
-	col := db.Collection("articles")
+	if logger == nil {
+		logger = log.Default()
+	}
 
 	repo := &mongoRepository{
-		col:    col,
-		logger: logger,
+		col:       db.Collection("articles"),
+		revisions: db.Collection("article_revisions"),
+		swept:     db.Collection(SweptCollection),
+		logger:    logger,
 	}
 	if err := repo.ensureIndexes(context.Background()); err != nil {
 		return nil, err
@@ -32,32 +52,106 @@ func NewMongoArticleRepository(db *mongo.Database, logger *log.Logger) (Reposito
 	return repo, nil
 }
 
+// NewMongoOutboxArticleRepository is NewMongoArticleRepository with every insert and update written in a
+// transaction together with its revision and an OutboxRecord, for event.OutboxRelay to publish. Transactions
+// need MongoDB to run as a replica set (a single node one is fine).
+func NewMongoOutboxArticleRepository(db *mongo.Database, logger *log.Logger) (Repository, error) {
+	repo, err := NewMongoArticleRepository(db, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	r := repo.(*mongoRepository)
+	r.outbox = db.Collection(OutboxCollection)
+	if err := r.ensureOutboxIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // ensureIndexes ensures that no article that shares a unique id from content-ecb (externalID)
-// can be inserted into db twice. it also ensures that data is ordered by `lastModified`
+// can be inserted into db twice. it also ensures that data is ordered by `lastModified` (with `_id` as the tie
+// breaker List pages on) and `date` (used by the retention sweep), and that each article can only have one
+// revision document per revision number.
+// the text index backs Search, its language override points at a field we never write so the article's own
+// `language` value isn't read as a stemming language (mongo rejects writes with languages it doesn't know)
 func (r *mongoRepository) ensureIndexes(ctx context.Context) error {
+	weights := bson.D{}
+	for _, field := range []string{"title", "description", "summary", "body"} {
+		weights = append(weights, bson.E{Key: field, Value: textWeights[field]})
+	}
+
 	indexes := []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "externalId", Value: 1}},
 			Options: options.Index().SetUnique(true),
 		},
 		{
-			Keys: bson.D{{Key: "lastModified", Value: 1}},
+			Keys: bson.D{{Key: "lastModified", Value: 1}, {Key: "_id", Value: 1}},
 		},
 		{
 			Keys: bson.D{{Key: "leadMedia.lastModified", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "date", Value: 1}},
+		},
+		{
+			Keys: bson.D{
+				{Key: "title", Value: "text"},
+				{Key: "description", Value: "text"},
+				{Key: "summary", Value: "text"},
+				{Key: "body", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("article_text").
+				SetWeights(weights).
+				SetLanguageOverride("textLanguage"),
+		},
+	}
+	if _, err := r.col.Indexes().CreateMany(ctx, indexes); err != nil {
+		r.logger.Printf("failed to create indexes: %v", err)
+		return err
 	}
-	_, err := r.col.Indexes().CreateMany(ctx, indexes)
 
+	_, err := r.revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "externalId", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
 	if err != nil {
-		r.logger.Printf("failed to create indexes: %v", err)
+		r.logger.Printf("failed to create revision indexes: %v", err)
+	}
+	return err
+}
+
+// ensureOutboxIndexes supports the relay reading pending records in write order, and drops published records
+// after a week.
+func (r *mongoRepository) ensureOutboxIndexes(ctx context.Context) error {
+	_, err := r.outbox.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "publishedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32((7 * 24 * time.Hour).Seconds())),
+		},
+	})
+	if err != nil {
+		r.logger.Printf("failed to create outbox indexes: %v", err)
 	}
 	return err
 }
 
-func (r *mongoRepository) BulkUpsert(ctx context.Context, articles []*Article) (int, error) {
+func (r *mongoRepository) BulkUpsert(ctx context.Context, articles []*Article) (UpsertResult, error) {
+	return r.bulkUpsert(ctx, articles, true)
+}
+
+// bulkUpsert does the work for BulkUpsert. writes that lose a race against another writer (an insert that
+// finds the document already created, or an update whose freshness filter no longer matches) are retried
+// once with a fresh read when retryLost is set, so the newest version wins regardless of who got there first.
+func (r *mongoRepository) bulkUpsert(ctx context.Context, articles []*Article, retryLost bool) (UpsertResult, error) {
+	var result UpsertResult
 	if len(articles) == 0 {
-		return 0, nil
+		return result, nil
 	}
 
 	// collect ids
@@ -70,7 +164,7 @@ func (r *mongoRepository) BulkUpsert(ctx context.Context, articles []*Article) (
 	// load the existing docs
 	cur, err := r.col.Find(ctx, bson.M{"externalId": bson.M{"$in": ids}})
 	if err != nil {
-		return 0, err
+		return result, err
 	}
 	defer cur.Close(ctx)
 
@@ -78,80 +172,559 @@ func (r *mongoRepository) BulkUpsert(ctx context.Context, articles []*Article) (
 	for cur.Next(ctx) {
 		var ex Article
 		if err := cur.Decode(&ex); err != nil {
-			return 0, err
+			return result, err
 		}
 		existingID[ex.ExternalID] = ex
 	}
 	if err := cur.Err(); err != nil {
-		return 0, err
+		return result, err
+	}
+	swept, err := r.sweptIDs(ctx, ids, existingID)
+	if err != nil {
+		return result, err
 	}
 
-	// build the bulk write based on lastModified rules
+	// build the bulk write based on lastModified rules. the existing docs above are only used to describe
+	// what changed (lastChanges and revisions), each write model carries its own freshness condition so a
+	// concurrent writer that got there first can never be overwritten with older data
 	now := time.Now()
+	runID := RunIDFromContext(ctx)
 	models := make([]mongo.WriteModel, 0, len(articles))
+	revisions := make([]Revision, 0, len(articles)) // revisions[i] is written only if models[i] applied
+	written := make([]*Article, 0, len(articles))   // written[i] is the article behind models[i]
+	inserts := make(map[int]struct{}, len(articles))
 
 	for _, a := range articles {
 		ex, found := existingID[a.ExternalID]
+		if _, ok := swept[a.ExternalID]; ok && !found {
+			// retention moved it out, the feed still returns it but it isn't new
+			result.Stale = append(result.Stale, a.ExternalID)
+			continue
+		}
 		if !found {
-			// new document insert
+			// new document, upsert with $setOnInsert so two runs inserting the same externalId at the same
+			// time both succeed, the second one simply matches the document the first one created
 			a.CreatedAt = now
 			a.ModifiedAt = now
-			models = append(models, mongo.NewInsertOneModel().SetDocument(a))
+			a.Revision = 1
+			inserts[len(models)] = struct{}{}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"externalId": a.ExternalID}).
+				SetUpdate(bson.M{"$setOnInsert": a}).
+				SetUpsert(true),
+			)
+			written = append(written, a)
+			revisions = append(revisions, Revision{
+				ExternalID: a.ExternalID,
+				Revision:   a.Revision,
+				Timestamp:  now,
+				RunID:      runID,
+				Article:    *a,
+			})
 			continue
 		}
 
 		// existing doc, decide if we need to update the whole article or the lead media, or both
-		shouldUpdateArticle := !a.LastModified.IsZero() && a.LastModified.After(ex.LastModified)
-		shouldUpdateMedia := !a.LeadMedia.LastModified.IsZero() && a.LeadMedia.LastModified.After(ex.LeadMedia.LastModified)
+		shouldUpdateArticle, shouldUpdateMedia := freshParts(&ex, a)
 
 		if !shouldUpdateMedia && !shouldUpdateArticle {
+			result.Stale = append(result.Stale, a.ExternalID)
 			continue // article hasn't changed
 		}
 
-		set := bson.M{}
+		changes := diffArticle(&ex, a, shouldUpdateArticle, shouldUpdateMedia)
+		next := mergeArticle(ex, a, shouldUpdateArticle, shouldUpdateMedia)
+		next.ModifiedAt = now
+		next.Revision = ex.Revision + 1
+		next.LastChanges = changes
+
+		// only match the document while the parts we are writing are still older than ours, and while it's still
+		// the revision we read: the revision record says ex.Revision+1, a writer that got in between makes this one
+		// lose the race and be retried against a fresh read instead of both claiming the same number
+		filter := bson.M{"externalId": a.ExternalID, "revision": ex.Revision}
+		if ex.Revision == 0 {
+			// written before migration v1 numbered the revisions, the field isn't there at all
+			delete(filter, "revision")
+			filter["$or"] = bson.A{bson.M{"revision": 0}, bson.M{"revision": bson.M{"$exists": false}}}
+		}
+		set := bson.M{"lastChanges": changes, "modifiedAt": now}
+		setOnInsert := bson.M{"createdAt": now}
+
 		if shouldUpdateArticle {
-			set["type"] = a.Type
-			set["title"] = a.Title
-			set["description"] = a.Description
-			set["date"] = a.Date
-			set["location"] = a.Location
-			set["language"] = a.Language
-			set["canonicalUrl"] = a.CanonicalURL
-			set["lastModified"] = a.LastModified
-			set["body"] = a.Body
-			set["summary"] = a.Summary
+			filter["lastModified"] = bson.M{"$lt": a.LastModified}
+			mergeFields(set, articleFields(a))
+		} else {
+			mergeFields(setOnInsert, articleFields(a))
 		}
 
 		if shouldUpdateMedia {
-			set["leadMedia"] = bson.M{
-				"id":           a.LeadMedia.ID,
-				"type":         a.LeadMedia.Type,
-				"title":        a.LeadMedia.Title,
-				"date":         a.LeadMedia.Date,
-				"language":     a.LeadMedia.Language,
-				"imageUrl":     a.LeadMedia.ImageURL,
-				"lastModified": a.LeadMedia.LastModified,
-			}
+			filter["leadMedia.lastModified"] = bson.M{"$lt": a.LeadMedia.LastModified}
+			set["leadMedia"] = leadMediaFields(a)
+		} else {
+			setOnInsert["leadMedia"] = leadMediaFields(a)
 		}
 
-		set["modifiedAt"] = now
-
-		update := bson.M{"$set": set}
+		// upsert so that when the filter doesn't match because a newer version is already stored the server
+		// rejects the insert on the unique externalId index, which tells us exactly which write was stale
 		models = append(models, mongo.NewUpdateOneModel().
-			SetFilter(bson.M{"externalId": a.ExternalID}).
-			SetUpdate(update),
+			SetFilter(filter).
+			SetUpdate(bson.M{"$set": set, "$setOnInsert": setOnInsert, "$inc": bson.M{"revision": 1}}).
+			SetUpsert(true),
 		)
+		written = append(written, a)
+		revisions = append(revisions, Revision{
+			ExternalID: a.ExternalID,
+			Revision:   next.Revision,
+			Timestamp:  now,
+			RunID:      runID,
+			Changes:    changes,
+			Article:    next,
+		})
 	}
 
 	if len(models) == 0 {
-		return 0, nil
+		return result, nil
+	}
+
+	var (
+		upserted map[int]struct{}
+		stale    map[int]struct{}
+		failed   map[int]string
+	)
+	if r.outbox != nil {
+		upserted, stale, failed, err = r.writeWithOutbox(ctx, models, revisions, inserts)
+		if err != nil {
+			return result, err
+		}
+	} else {
+		// do bulk write (unordered for concurrency and to prevent stopping on a single failure)
+		res, err := r.col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		stale, failed, err = classifyWriteErrors(err)
+		if err != nil {
+			return result, err
+		}
+		upserted = make(map[int]struct{}, len(res.UpsertedIDs))
+		for i := range res.UpsertedIDs {
+			upserted[int(i)] = struct{}{}
+		}
+	}
+
+	applied := make([]any, 0, len(revisions))
+	lost := make([]*Article, 0)
+	for i, rev := range revisions {
+		if reason, ok := failed[i]; ok {
+			result.Failed = append(result.Failed, UpsertFailure{ExternalID: rev.ExternalID, Reason: reason})
+			continue
+		}
+		if _, ok := stale[i]; ok {
+			lost = append(lost, written[i])
+			continue
+		}
+		if _, ok := inserts[i]; ok {
+			if _, ok := upserted[i]; !ok {
+				// another writer inserted it first
+				lost = append(lost, written[i])
+				continue
+			}
+			result.Inserted = append(result.Inserted, rev.ExternalID)
+		} else {
+			result.Updated = append(result.Updated, rev.ExternalID)
+		}
+		applied = append(applied, rev)
+	}
+
+	if len(applied) > 0 && r.outbox == nil {
+		// revisions are written after the articles, a failure here doesn't undo the article write so we only log it
+		if _, err := r.revisions.InsertMany(ctx, applied, options.InsertMany().SetOrdered(false)); err != nil {
+			r.logger.Printf("failed to write %d article revisions: %v", len(applied), err)
+		}
+	}
+
+	if len(lost) == 0 {
+		return result, nil
+	}
+	if !retryLost {
+		// lost the race a second time, report it as failed so ingest retries it rather than dropping it as stale.
+		// a genuinely stale article is caught by freshParts against the fresh read and never gets here
+		for _, a := range lost {
+			result.Failed = append(result.Failed, UpsertFailure{ExternalID: a.ExternalID, Reason: lostRaceTwiceReason})
+		}
+		return result, nil
+	}
+
+	retried, err := r.bulkUpsert(ctx, lost, false)
+	if err != nil {
+		for _, a := range lost {
+			result.Failed = append(result.Failed, UpsertFailure{ExternalID: a.ExternalID, Reason: err.Error()})
+		}
+		return result, nil
+	}
+	result.Inserted = append(result.Inserted, retried.Inserted...)
+	result.Updated = append(result.Updated, retried.Updated...)
+	result.Stale = append(result.Stale, retried.Stale...)
+	result.Failed = append(result.Failed, retried.Failed...)
+	return result, nil
+}
+
+// sweptIDs returns which of the ids that aren't in existing were swept by retention.
+func (r *mongoRepository) sweptIDs(ctx context.Context, ids []int64, existing map[int64]Article) (map[int64]struct{}, error) {
+	missing := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := existing[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	swept := make(map[int64]struct{})
+	if len(missing) == 0 {
+		return swept, nil
+	}
+
+	cur, err := r.swept.Find(ctx, bson.M{"_id": bson.M{"$in": missing}})
+	if err != nil {
+		return nil, err
+	}
+	var records []Swept
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	for _, s := range records {
+		swept[s.ExternalID] = struct{}{}
+	}
+	return swept, nil
+}
+
+const lostRaceTwiceReason = "lost the race to a concurrent write twice"
+
+// errInsertLost aborts an outbox transaction whose insert matched a document another writer created first.
+var errInsertLost = errors.New("article: insert lost to a concurrent writer")
+
+// writeWithOutbox applies each write model in its own transaction together with its revision and outbox
+// record. It reports the outcome the same way as the plain BulkWrite path: which inserts were upserted, which
+// writes lost a freshness check and which failed, by index of the model. A write error inside a transaction
+// aborts all of it, which is why the articles aren't batched into a single one.
+func (r *mongoRepository) writeWithOutbox(
+	ctx context.Context,
+	models []mongo.WriteModel,
+	revisions []Revision,
+	inserts map[int]struct{},
+) (map[int]struct{}, map[int]struct{}, map[int]string, error) {
+	upserted := make(map[int]struct{})
+	stale := make(map[int]struct{})
+	failed := make(map[int]string)
+
+	sess, err := r.col.Database().Client().StartSession()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	for i, m := range models {
+		_, insert := inserts[i]
+		rev := revisions[i]
+
+		_, err := sess.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+			res, err := r.col.BulkWrite(sc, []mongo.WriteModel{m})
+			if err != nil {
+				return nil, err
+			}
+
+			op := ChangeUpdate
+			if insert {
+				id, ok := res.UpsertedIDs[0].(primitive.ObjectID)
+				if !ok {
+					return nil, errInsertLost
+				}
+				op = ChangeInsert
+				rev.Article.ID = id
+			}
+
+			if _, err := r.revisions.InsertOne(sc, rev); err != nil {
+				return nil, err
+			}
+			_, err = r.outbox.InsertOne(sc, newOutboxRecord(op, rev))
+			return nil, err
+		})
+
+		if err == nil {
+			if insert {
+				upserted[i] = struct{}{}
+			}
+			continue
+		}
+		if errors.Is(err, errInsertLost) {
+			continue // not upserted, reported as lost by the caller
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, nil, ctxErr
+		}
+
+		s, f, err := classifyWriteErrors(err)
+		switch {
+		case err != nil:
+			failed[i] = err.Error()
+		case len(s) > 0:
+			stale[i] = struct{}{}
+		default:
+			failed[i] = f[0]
+		}
+	}
+	return upserted, stale, failed, nil
+}
+
+// classifyWriteErrors splits the error returned by BulkWrite by the index of the write model it belongs to.
+// Duplicate key errors are writes that lost a freshness check (the upsert collided with the newer stored
+// document) and are returned as stale, any other write error is returned as failed with the server message.
+// Errors that aren't tied to a single write, like a network or write concern error, are returned as is.
+func classifyWriteErrors(err error) (map[int]struct{}, map[int]string, error) {
+	stale := make(map[int]struct{})
+	failed := make(map[int]string)
+	if err == nil {
+		return stale, failed, nil
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+		return stale, failed, err
+	}
+
+	for _, we := range bwe.WriteErrors {
+		if mongo.IsDuplicateKeyError(we.WriteError) {
+			stale[we.Index] = struct{}{}
+			continue
+		}
+		failed[we.Index] = fmt.Sprintf("code %d: %s", we.Code, we.Message)
+	}
+	return stale, failed, nil
+}
+
+func articleFields(a *Article) bson.M {
+	return bson.M{
+		"type":         a.Type,
+		"title":        a.Title,
+		"description":  a.Description,
+		"date":         a.Date,
+		"location":     a.Location,
+		"language":     a.Language,
+		"canonicalUrl": a.CanonicalURL,
+		"lastModified": a.LastModified,
+		"body":         a.Body,
+		"summary":      a.Summary,
+		"tags":         a.Tags,
+	}
+}
+
+func leadMediaFields(a *Article) bson.M {
+	return bson.M{
+		"id":           a.LeadMedia.ID,
+		"type":         a.LeadMedia.Type,
+		"title":        a.LeadMedia.Title,
+		"date":         a.LeadMedia.Date,
+		"language":     a.LeadMedia.Language,
+		"imageUrl":     a.LeadMedia.ImageURL,
+		"lastModified": a.LeadMedia.LastModified,
+	}
+}
+
+func mergeFields(dst, src bson.M) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// mergeArticle returns the state the stored article will have once the update built in BulkUpsert is applied.
+func mergeArticle(ex Article, a *Article, article, media bool) Article {
+	next := ex
+	if article {
+		next.Type = a.Type
+		next.Title = a.Title
+		next.Description = a.Description
+		next.Date = a.Date
+		next.Location = a.Location
+		next.Language = a.Language
+		next.CanonicalURL = a.CanonicalURL
+		next.LastModified = a.LastModified
+		next.Body = a.Body
+		next.Summary = a.Summary
+		next.Tags = a.Tags
+	}
+	if media {
+		next.LeadMedia = a.LeadMedia
+	}
+	return next
+}
+
+func (r *mongoRepository) GetByExternalID(ctx context.Context, externalID int64) (*Article, error) {
+	return r.findOne(ctx, bson.M{"externalId": externalID})
+}
+
+func (r *mongoRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoRepository) findOne(ctx context.Context, filter bson.M) (*Article, error) {
+	var a Article
+	err := r.col.FindOne(ctx, filter).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// List pages through articles using a keyset cursor on the sort field, both sorts are backed by the indexes in
+// ensureIndexes. ties on lastModified are broken on _id so pages never overlap or skip, externalId is unique and
+// sorts on its own.
+func (r *mongoRepository) List(ctx context.Context, q ListQuery) (ListPage, error) {
+	var page ListPage
+
+	q, err := q.normalise()
+	if err != nil {
+		return page, err
+	}
+
+	field := string(q.SortBy)
+	dir, op := 1, "$gt"
+	if q.Descending {
+		dir, op = -1, "$lt"
+	}
+
+	filter := filterDoc(q.Filter)
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return page, err
+		}
+
+		var value any = c.value
+		if q.SortBy == SortByLastModified {
+			value = time.Unix(0, c.value)
+		}
+		filter["$or"] = bson.A{
+			bson.M{field: bson.M{op: value}},
+			bson.M{field: value, "_id": bson.M{op: c.id}},
+		}
+	}
+
+	sort := bson.D{{Key: field, Value: dir}}
+	if q.SortBy == SortByLastModified {
+		sort = append(sort, bson.E{Key: "_id", Value: dir})
+	}
+	opts := options.Find().
+		SetSort(sort).
+		SetLimit(int64(q.Limit) + 1) // one extra to know if there's another page
+
+	cur, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return page, err
+	}
+	defer cur.Close(ctx)
+
+	page.Articles = make([]*Article, 0, q.Limit)
+	if err := cur.All(ctx, &page.Articles); err != nil {
+		return page, err
+	}
+
+	if len(page.Articles) > q.Limit {
+		page.Articles = page.Articles[:q.Limit]
+		page.NextCursor = cursorFor(page.Articles[q.Limit-1], q.SortBy).encode()
+	}
+	return page, nil
+}
+
+func (r *mongoRepository) Count(ctx context.Context, f Filter) (int64, error) {
+	return r.col.CountDocuments(ctx, filterDoc(f))
+}
+
+// Search ranks matches with the text index score, filters are applied in the same query.
+func (r *mongoRepository) Search(ctx context.Context, q SearchQuery) ([]SearchHit, error) {
+	q, err := q.normalise()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := filterDoc(q.Filter)
+	filter["$text"] = bson.M{"$search": q.Text}
+
+	score := bson.M{"$meta": "textScore"}
+	cur, err := r.col.Find(ctx, filter, options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}}).
+		SetLimit(int64(q.Limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	hits := make([]SearchHit, 0)
+	for cur.Next(ctx) {
+		var doc struct {
+			Article `bson:",inline"`
+			Score   float64 `bson:"score"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		a := doc.Article
+		hits = append(hits, SearchHit{Article: &a, Score: doc.Score})
+	}
+	return hits, cur.Err()
+}
+
+// filterDoc translates a Filter into a mongo query document.
+func filterDoc(f Filter) bson.M {
+	filter := bson.M{}
+	if f.Type != "" {
+		filter["type"] = f.Type
+	}
+	if f.Language != "" {
+		filter["language"] = f.Language
+	}
+
+	date := bson.M{}
+	if !f.DateFrom.IsZero() {
+		date["$gte"] = f.DateFrom
+	}
+	if !f.DateTo.IsZero() {
+		date["$lt"] = f.DateTo
+	}
+	if len(date) > 0 {
+		filter["date"] = date
+	}
+
+	if !f.ModifiedSince.IsZero() {
+		filter["lastModified"] = bson.M{"$gte": f.ModifiedSince}
 	}
+	return filter
+}
 
-	// do bulk write (unordered for concurrency and to prevent stopping on a single failure)
-	res, err := r.col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+func (r *mongoRepository) ListRevisions(ctx context.Context, externalID int64) ([]Revision, error) {
+	cur, err := r.revisions.Find(ctx,
+		bson.M{"externalId": externalID},
+		options.Find().SetSort(bson.D{{Key: "revision", Value: 1}}),
+	)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	revisions := make([]Revision, 0)
+	if err := cur.All(ctx, &revisions); err != nil {
+		return nil, err
 	}
+	return revisions, nil
+}
 
-	return int(res.InsertedCount + res.ModifiedCount + res.UpsertedCount), nil
+func (r *mongoRepository) GetRevision(ctx context.Context, externalID int64, revision int) (*Revision, error) {
+	var rev Revision
+	err := r.revisions.FindOne(ctx, bson.M{"externalId": externalID, "revision": revision}).Decode(&rev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
 }
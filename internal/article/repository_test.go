@@ -2,7 +2,6 @@ package article_test
 
 import (
 	"context"
-	"go.mongodb.org/mongo-driver/bson"
 	"testing"
 	"time"
 
@@ -10,6 +9,7 @@ import (
 	"cortex-task/internal/db"
 
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -72,12 +72,11 @@ func (s *ArticleIngestionSuite) TestArticleIngestionEndToEnd() {
 		},
 	}
 
-	changed, err := s.repo.BulkUpsert(s.ctx, []*article.Article{&A1})
+	res, err := s.repo.BulkUpsert(s.ctx, []*article.Article{&A1})
 	s.Require().NoError(err)
-	s.Require().Equal(1, changed, "first insert, change 1 document")
+	s.Require().Equal(1, res.Changed(), "first insert, change 1 document")
 
-	var gotA1 article.Article
-	err = s.col.FindOne(s.ctx, map[string]any{"externalId": 1001}).Decode(&gotA1)
+	gotA1, err := s.repo.GetByExternalID(s.ctx, 1001)
 	s.Require().NoError(err)
 	s.Equal("Title", gotA1.Title)
 	s.Equal(time.Unix(1700000000, 0), gotA1.LastModified)
@@ -93,12 +92,11 @@ func (s *ArticleIngestionSuite) TestArticleIngestionEndToEnd() {
 		},
 	}
 
-	changed, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A2})
+	res, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A2})
 	s.Require().NoError(err)
-	s.Require().Equal(1, changed, "second insert, change 1 document")
+	s.Require().Equal(1, res.Changed(), "second insert, change 1 document")
 
-	var gotA2 article.Article
-	err = s.col.FindOne(s.ctx, map[string]any{"externalId": 1002}).Decode(&gotA2)
+	gotA2, err := s.repo.GetByExternalID(s.ctx, 1002)
 	s.Require().NoError(err)
 	s.Equal("Second Title", gotA2.Title)
 
@@ -115,12 +113,11 @@ func (s *ArticleIngestionSuite) TestArticleIngestionEndToEnd() {
 		},
 	}
 
-	changed, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A3})
+	res, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A3})
 	s.Require().NoError(err)
-	s.Require().Equal(1, changed, "newer article LastModified should trigger 1 update")
+	s.Require().Equal(1, res.Changed(), "newer article LastModified should trigger 1 update")
 
-	var gotA3 article.Article
-	err = s.col.FindOne(s.ctx, map[string]any{"externalId": 1001}).Decode(&gotA3)
+	gotA3, err := s.repo.GetByExternalID(s.ctx, 1001)
 	s.Require().NoError(err)
 	s.Equal("Updated Title", gotA3.Title)
 	s.Equal(time.Unix(1700000500, 0), gotA3.LastModified)
@@ -141,12 +138,11 @@ func (s *ArticleIngestionSuite) TestArticleIngestionEndToEnd() {
 		},
 	}
 
-	changed, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A4})
+	res, err = s.repo.BulkUpsert(s.ctx, []*article.Article{&A4})
 	s.Require().NoError(err)
-	s.Require().Equal(1, changed, "newer leadMedia LastModified should trigger 1 update")
+	s.Require().Equal(1, res.Changed(), "newer leadMedia LastModified should trigger 1 update")
 
-	var gotA4 article.Article
-	err = s.col.FindOne(s.ctx, map[string]any{"externalId": 1001}).Decode(&gotA4)
+	gotA4, err := s.repo.GetByExternalID(s.ctx, 1001)
 	s.Require().NoError(err)
 
 	// article fields unchanged from A3
@@ -158,7 +154,46 @@ func (s *ArticleIngestionSuite) TestArticleIngestionEndToEnd() {
 	s.Equal("Lead UPDATED", gotA4.LeadMedia.Title)
 	s.Equal(time.Unix(1700000900, 0), gotA4.LeadMedia.LastModified)
 
-	count, err := s.col.CountDocuments(s.ctx, bson.M{})
+	count, err := s.repo.Count(s.ctx, article.Filter{})
 	s.Require().NoError(err)
 	s.Equal(int64(2), count, "only two unique ExternalIDs should exist")
 }
+
+func (s *ArticleIngestionSuite) TestUpdatesArticleWrittenBeforeRevisions() {
+	// as stored before migration v1, without a revision field
+	_, err := s.col.InsertOne(s.ctx, bson.M{
+		"externalId":   int64(1002),
+		"title":        "Old Title",
+		"lastModified": time.Unix(1700000000, 0),
+		"leadMedia":    bson.M{"lastModified": time.Unix(1700000000, 0)},
+	})
+	s.Require().NoError(err)
+
+	res, err := s.repo.BulkUpsert(s.ctx, []*article.Article{{
+		ExternalID:   1002,
+		Title:        "New Title",
+		LastModified: time.Unix(1700000500, 0),
+		LeadMedia:    article.LeadMedia{LastModified: time.Unix(1700000000, 0)},
+	}})
+	s.Require().NoError(err)
+	s.Equal([]int64{1002}, res.Updated)
+	s.Empty(res.Stale)
+
+	got, err := s.repo.GetByExternalID(s.ctx, 1002)
+	s.Require().NoError(err)
+	s.Equal("New Title", got.Title)
+	s.Equal(1, got.Revision)
+}
+
+func (s *ArticleIngestionSuite) TestSkipsArticlesSweptByRetention() {
+	_, err := s.db.Collection(article.SweptCollection).InsertOne(s.ctx, article.Swept{ExternalID: 1003, SweptAt: time.Now()})
+	s.Require().NoError(err)
+
+	res, err := s.repo.BulkUpsert(s.ctx, []*article.Article{{ExternalID: 1003, LastModified: time.Unix(1700000000, 0)}})
+	s.Require().NoError(err)
+	s.Equal([]int64{1003}, res.Stale)
+	s.Empty(res.Inserted)
+
+	_, err = s.repo.GetByExternalID(s.ctx, 1003)
+	s.ErrorIs(err, article.ErrNotFound)
+}
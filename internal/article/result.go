@@ -0,0 +1,30 @@
+package article
+
+// UpsertResult reports what BulkUpsert did with every article it was given, each externalId appears in
+// exactly one of the lists.
+type UpsertResult struct {
+	Inserted []int64
+	Updated  []int64
+	Stale    []int64 // not newer than the stored version or swept by retention, nothing written
+	Failed   []UpsertFailure
+}
+
+// UpsertFailure is a single article the database refused to write.
+type UpsertFailure struct {
+	ExternalID int64
+	Reason     string
+}
+
+// Changed returns how many documents were inserted or updated.
+func (r UpsertResult) Changed() int {
+	return len(r.Inserted) + len(r.Updated)
+}
+
+// FailedIDs returns the externalIds of every failed article.
+func (r UpsertResult) FailedIDs() []int64 {
+	ids := make([]int64, 0, len(r.Failed))
+	for _, f := range r.Failed {
+		ids = append(ids, f.ExternalID)
+	}
+	return ids
+}
@@ -0,0 +1,34 @@
+package article
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision is an immutable snapshot of an article written every time BulkUpsert inserts or updates it.
+// Revision numbers start at 1 for the insert and increase by one for each update of the same externalId.
+type Revision struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ExternalID int64              `bson:"externalId" json:"externalId"`
+	Revision   int                `bson:"revision" json:"revision"`
+	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
+	RunID      string             `bson:"runId,omitempty" json:"runId,omitempty"`
+	Changes    []FieldChange      `bson:"changes,omitempty" json:"changes,omitempty"`
+	Article    Article            `bson:"article" json:"article"`
+}
+
+type runIDKey struct{}
+
+// WithRunID tags ctx with the id of the ingest run performing the writes, it's stored on each revision so
+// we can trace a change back to the poll that produced it.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// RunIDFromContext returns the ingest run id set by WithRunID, or an empty string.
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,109 @@
+package article
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const DefaultSearchLimit = 20
+
+// ErrEmptySearch is returned by Search when the query has no terms.
+var ErrEmptySearch = errors.New("article: empty search query")
+
+// textWeights is how much a match in each field counts towards the relevance score, it's used for the Mongo
+// text index and the in-process scoring of the other repositories so results rank the same everywhere.
+var textWeights = map[string]int{
+	"title":       10,
+	"description": 5,
+	"summary":     3,
+	"body":        1,
+}
+
+type SearchQuery struct {
+	Filter        // Type, Language and the date range apply, ModifiedSince too
+	Text   string // keywords, an article matches if it contains any of them
+	Limit  int    // defaults to DefaultSearchLimit, capped at MaxListLimit
+}
+
+type SearchHit struct {
+	Article *Article `json:"article"`
+	Score   float64  `json:"score"`
+}
+
+func (q SearchQuery) normalise() (SearchQuery, error) {
+	if len(searchTerms(q.Text)) == 0 {
+		return q, ErrEmptySearch
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit > MaxListLimit {
+		q.Limit = MaxListLimit
+	}
+	return q, nil
+}
+
+// searchTerms splits text into lower case words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// textScore is a simple weighted term frequency, the in-process stand-in for Mongo's text score.
+func textScore(a *Article, terms []string) float64 {
+	fields := map[string]string{
+		"title":       a.Title,
+		"description": a.Description,
+		"summary":     a.Summary,
+		"body":        a.Body,
+	}
+
+	var score float64
+	for field, value := range fields {
+		words := searchTerms(value)
+		if len(words) == 0 {
+			continue
+		}
+
+		matches := 0
+		for _, w := range words {
+			for _, t := range terms {
+				if w == t {
+					matches++
+				}
+			}
+		}
+		score += float64(textWeights[field]*matches) / float64(len(words))
+	}
+	return score
+}
+
+// searchArticles scores candidates against q and returns the best hits, highest score first.
+func searchArticles(candidates []*Article, q SearchQuery) []SearchHit {
+	terms := searchTerms(q.Text)
+
+	hits := make([]SearchHit, 0)
+	for _, a := range candidates {
+		if !matchesFilter(a, q.Filter) {
+			continue
+		}
+		if score := textScore(a, terms); score > 0 {
+			hits = append(hits, SearchHit{Article: a, Score: score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Article.ExternalID < hits[j].Article.ExternalID
+	})
+
+	if len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits
+}
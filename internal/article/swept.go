@@ -0,0 +1,13 @@
+package article
+
+import "time"
+
+// SweptCollection records the articles retention moved out of articles. The feed keeps returning old articles,
+// without it they'd be inserted again as new ones on the next poll, and swept again on the next sweep.
+const SweptCollection = "articles_swept"
+
+// Swept is the record retention leaves behind for an article it swept, BulkUpsert skips its externalId.
+type Swept struct {
+	ExternalID int64     `bson:"_id"`
+	SweptAt    time.Time `bson:"sweptAt"`
+}
@@ -0,0 +1,76 @@
+package article
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassifyWriteErrors(t *testing.T) {
+	err := mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key"}},
+			{WriteError: mongo.WriteError{Index: 2, Code: 121, Message: "Document failed validation"}},
+			{WriteError: mongo.WriteError{Index: 3, Code: 11000, Message: "E11000 duplicate key"}},
+		},
+	}
+
+	stale, failed, rest := classifyWriteErrors(err)
+
+	require.NoError(t, rest)
+	assert.Equal(t, map[int]struct{}{1: {}, 3: {}}, stale)
+	assert.Equal(t, map[int]string{2: "code 121: Document failed validation"}, failed)
+}
+
+func TestClassifyWriteErrors_BatchErrorsBubble(t *testing.T) {
+	boom := errors.New("boom")
+	_, _, rest := classifyWriteErrors(boom)
+	assert.Equal(t, boom, rest)
+
+	wce := mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}}
+	_, _, rest = classifyWriteErrors(wce)
+	assert.Equal(t, wce, rest)
+}
+
+func TestUpsertResult(t *testing.T) {
+	res := UpsertResult{
+		Inserted: []int64{1},
+		Updated:  []int64{2, 3},
+		Stale:    []int64{4},
+		Failed:   []UpsertFailure{{ExternalID: 5, Reason: "boom"}},
+	}
+
+	assert.Equal(t, 3, res.Changed())
+	assert.Equal(t, []int64{5}, res.FailedIDs())
+}
+
+func TestNewOutboxRecord(t *testing.T) {
+	now := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	changes := []FieldChange{{Field: "title", Old: "Old", New: "New"}}
+	rev := Revision{
+		ExternalID: 7,
+		Revision:   3,
+		Timestamp:  now,
+		RunID:      "run-1",
+		Changes:    changes,
+		Article:    Article{ExternalID: 7, Title: "New"},
+	}
+
+	rec := newOutboxRecord(ChangeUpdate, rev)
+
+	assert.Equal(t, OutboxRecord{
+		ExternalID:    7,
+		Revision:      3,
+		Op:            ChangeUpdate,
+		RunID:         "run-1",
+		CreatedAt:     now,
+		Changes:       changes,
+		Article:       Article{ExternalID: 7, Title: "New"},
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+	}, rec)
+}
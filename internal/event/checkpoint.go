@@ -0,0 +1,75 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const checkpointsCollection = "event_checkpoints"
+
+// Server error codes for a resume token the change stream can no longer start from.
+const (
+	codeInvalidResumeToken  = 260
+	codeChangeStreamHistory = 286 // ChangeStreamHistoryLost, the token has aged out of the oplog
+)
+
+// CheckpointStore keeps the resume token of the last change stream event that was published.
+type CheckpointStore interface {
+	// Load returns the stored token, or nil when there isn't one yet.
+	Load(ctx context.Context) (bson.Raw, error)
+	Save(ctx context.Context, token bson.Raw) error
+}
+
+type checkpoint struct {
+	ID        string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+type mongoCheckpointStore struct {
+	col  *mongo.Collection
+	name string
+}
+
+// NewMongoCheckpointStore stores the token in event_checkpoints under name, one document per stream.
+func NewMongoCheckpointStore(db *mongo.Database, name string) CheckpointStore {
+	return &mongoCheckpointStore{
+		col:  db.Collection(checkpointsCollection),
+		name: name,
+	}
+}
+
+func (s *mongoCheckpointStore) Load(ctx context.Context) (bson.Raw, error) {
+	var cp checkpoint
+	err := s.col.FindOne(ctx, bson.M{"_id": s.name}).Decode(&cp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp.Token, nil
+}
+
+func (s *mongoCheckpointStore) Save(ctx context.Context, token bson.Raw) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": s.name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// isResumeTokenLost reports whether err means the stream can't be resumed from the stored token.
+func isResumeTokenLost(err error) bool {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.HasErrorCode(codeChangeStreamHistory) || se.HasErrorCode(codeInvalidResumeToken)
+}
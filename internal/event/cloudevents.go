@@ -0,0 +1,222 @@
+package event
+
+import (
+	"cortex-task/internal/article"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Message schema versions, more than one can be published side by side while consumers migrate.
+const (
+	SchemaV1 = 1 // ArticleUpdatedMessage and friends, Go field names for the article
+	SchemaV2 = 2 // CloudEvents envelope with camelCase data, routed under "v2." + the v1 routing key
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	dataSchemaPrefix       = "urn:news-sync:schema:"
+)
+
+// MessageFormat is what the publisher puts on the wire for each event.
+type MessageFormat struct {
+	Payload  PayloadMode
+	Versions []int  // every version listed is published for every event, defaults to SchemaV1
+	Source   string // CloudEvents source of this service
+}
+
+func (f MessageFormat) versions() []int {
+	if len(f.Versions) == 0 {
+		return []int{SchemaV1}
+	}
+	return f.Versions
+}
+
+// CloudEvent is a CloudEvents 1.0 event in the structured JSON format. The attribute names are the ones from
+// the spec, Data is one of the Article*Data types below as described by DataSchema.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"` // the externalId
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	DataSchema      string    `json:"dataschema"`
+	Data            any       `json:"data"`
+}
+
+type ArticleData struct {
+	ID           string        `json:"id"`
+	ExternalID   int64         `json:"externalId"`
+	Type         string        `json:"type"`
+	Title        string        `json:"title"`
+	Description  string        `json:"description"`
+	Date         time.Time     `json:"date"`
+	Location     string        `json:"location"`
+	Language     string        `json:"language"`
+	CanonicalURL string        `json:"canonicalUrl"`
+	LastModified time.Time     `json:"lastModified"`
+	Body         string        `json:"body"`
+	Summary      string        `json:"summary"`
+	Tags         []string      `json:"tags,omitempty"`
+	LeadMedia    LeadMediaData `json:"leadMedia"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	ModifiedAt   time.Time     `json:"modifiedAt"`
+	Revision     int           `json:"revision"`
+}
+
+type LeadMediaData struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Title        string    `json:"title"`
+	Date         time.Time `json:"date"`
+	Language     string    `json:"language"`
+	ImageURL     string    `json:"imageUrl"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ArticleSnapshotData is the data of full payload events.
+type ArticleSnapshotData struct {
+	Changes []article.FieldChange `json:"changes,omitempty"`
+	Article ArticleData           `json:"article"`
+}
+
+// ArticleReferenceData is the data of reference payload events.
+type ArticleReferenceData struct {
+	DocumentID   string    `json:"documentId"`
+	ExternalID   int64     `json:"externalId"`
+	LastModified time.Time `json:"lastModified"`
+	Revision     int       `json:"revision"`
+}
+
+// ArticleDeltaData is the data of delta payload events.
+type ArticleDeltaData struct {
+	ArticleReferenceData
+	Updated map[string]any `json:"updated,omitempty"`
+	Removed []string       `json:"removed,omitempty"`
+}
+
+// ArticleDeletedData is the data of article.deleted events in every payload mode.
+type ArticleDeletedData struct {
+	DocumentID string `json:"documentId"`
+	ExternalID int64  `json:"externalId,omitempty"`
+}
+
+func newArticleData(a *article.Article) ArticleData {
+	return ArticleData{
+		ID:           a.ID.Hex(),
+		ExternalID:   a.ExternalID,
+		Type:         a.Type,
+		Title:        a.Title,
+		Description:  a.Description,
+		Date:         a.Date,
+		Location:     a.Location,
+		Language:     a.Language,
+		CanonicalURL: a.CanonicalURL,
+		LastModified: a.LastModified,
+		Body:         a.Body,
+		Summary:      a.Summary,
+		Tags:         a.Tags,
+		LeadMedia: LeadMediaData{
+			ID:           a.LeadMedia.ID,
+			Type:         a.LeadMedia.Type,
+			Title:        a.LeadMedia.Title,
+			Date:         a.LeadMedia.Date,
+			Language:     a.LeadMedia.Language,
+			ImageURL:     a.LeadMedia.ImageURL,
+			LastModified: a.LeadMedia.LastModified,
+		},
+		CreatedAt:  a.CreatedAt,
+		ModifiedAt: a.ModifiedAt,
+		Revision:   a.Revision,
+	}
+}
+
+// eventID is the same for every publish of the same change, so a consumer can drop the repeats a restart or a
+// retry produces: an article event is identified by its revision, a delete by the document it removed. It's the
+// CloudEvents id and the AMQP message id of every version.
+func eventID(e Event) string {
+	if e.Type == ArticleDeleted || e.Article == nil {
+		return fmt.Sprintf("%s:%s", e.Type, e.DocumentID.Hex())
+	}
+	if e.Article.Revision == 0 {
+		// written before revisions existed, the content tells one version from the next
+		return fmt.Sprintf("%s:%d:h%s", e.Type, e.ExternalID, articleHash(e.Article))
+	}
+	return fmt.Sprintf("%s:%d:%d", e.Type, e.ExternalID, e.Article.Revision)
+}
+
+// articleHash is a short hash of the article's version 1 JSON, which is deterministic: struct fields keep their
+// order and map keys are sorted.
+func articleHash(a *article.Article) string {
+	b, _ := json.Marshal(newArticleV1(a))
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// cloudEventBody encodes e as a SchemaV2 message.
+func cloudEventBody(e Event, f MessageFormat, now time.Time) ([]byte, error) {
+	ce := CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              eventID(e),
+		Source:          f.Source,
+		Type:            string(e.Type),
+		Time:            now,
+		DataContentType: "application/json",
+	}
+	if e.ExternalID != 0 {
+		ce.Subject = strconv.FormatInt(e.ExternalID, 10)
+	}
+
+	if e.Type == ArticleDeleted {
+		ce.DataSchema = dataSchema("article.deleted")
+		ce.Data = ArticleDeletedData{DocumentID: e.DocumentID.Hex(), ExternalID: e.ExternalID}
+		return json.Marshal(ce)
+	}
+	if e.Article == nil {
+		return nil, fmt.Errorf("event: %s for %d has no article", e.Type, e.ExternalID)
+	}
+
+	ref := ArticleReferenceData{
+		DocumentID:   e.DocumentID.Hex(),
+		ExternalID:   e.ExternalID,
+		LastModified: e.Article.LastModified,
+		Revision:     e.Article.Revision,
+	}
+	switch f.Payload {
+	case PayloadReference:
+		ce.DataSchema = dataSchema("article.reference")
+		ce.Data = ref
+	case PayloadDelta:
+		ce.DataSchema = dataSchema("article.delta")
+		ce.Data = ArticleDeltaData{ArticleReferenceData: ref, Updated: e.Updated, Removed: e.Removed}
+	default:
+		ce.DataSchema = dataSchema("article")
+		ce.Data = ArticleSnapshotData{Changes: e.Changes, Article: newArticleData(e.Article)}
+	}
+	return json.Marshal(ce)
+}
+
+// newestMessageBody encodes e in the newest schema version of f, for sinks that take one message per event.
+func newestMessageBody(e Event, f MessageFormat, now time.Time) ([]byte, string, error) {
+	if slices.Contains(f.versions(), SchemaV2) {
+		body, err := cloudEventBody(e, f, now)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %w", ErrUnencodable, err)
+		}
+		return body, cloudEventsContentType, nil
+	}
+	body, err := messageBody(e, f.Payload, now)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrUnencodable, err)
+	}
+	return body, "application/json", nil
+}
+
+func dataSchema(name string) string {
+	return fmt.Sprintf("%s%s:%d", dataSchemaPrefix, name, SchemaV2)
+}
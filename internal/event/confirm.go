@@ -0,0 +1,72 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	maxPublishAttempts = 4
+	publishRetryDelay  = 200 * time.Millisecond // doubled after each attempt
+)
+
+var (
+	// ErrNacked is returned when the broker rejects a message it couldn't take responsibility for.
+	ErrNacked = errors.New("event: message nacked by broker")
+	// ErrUnconfirmed is returned when the broker doesn't confirm a message within the confirm timeout.
+	ErrUnconfirmed = errors.New("event: message not confirmed by broker")
+)
+
+// confirmingChannel is an amqp channel in confirm mode, PublishWithContext only returns once the broker has
+// acked the message, or with ErrNacked / ErrUnconfirmed when it didn't.
+type confirmingChannel struct {
+	ch      *amqp.Channel
+	timeout time.Duration
+}
+
+func newConfirmingChannel(ch *amqp.Channel, timeout time.Duration) (*confirmingChannel, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("enabling publisher confirms failed: %w", err)
+	}
+	return &confirmingChannel{ch: ch, timeout: timeout}, nil
+}
+
+func (c *confirmingChannel) PublishWithContext(
+	ctx context.Context,
+	exchange, key string,
+	mandatory, immediate bool,
+	msg amqp.Publishing,
+) error {
+	dc, err := c.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	acked, err := dc.WaitContext(waitCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w after %v", ErrUnconfirmed, c.timeout)
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+func (c *confirmingChannel) Close() error {
+	return c.ch.Close()
+}
+
+// publishRetryable reports whether a failed publish is worth retrying.
+func publishRetryable(err error) bool {
+	return errors.Is(err, ErrNacked) || errors.Is(err, ErrUnconfirmed) || errors.Is(err, amqp.ErrClosed)
+}
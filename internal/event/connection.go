@@ -0,0 +1,198 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type ConnState string
+
+const (
+	StateConnected    ConnState = "connected"
+	StateReconnecting ConnState = "reconnecting"
+	StateClosed       ConnState = "closed"
+
+	reconnectBaseDelay = 500 * time.Millisecond
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+// ErrPublisherClosed is returned by publishes after Close.
+var ErrPublisherClosed = errors.New("event: publisher closed")
+
+// dial opens a connection and a confirm mode channel, and declares the exchange.
+func (p *RabbitPublisher) dial() (*amqp.Connection, *confirmingChannel, error) {
+	conn, err := amqp.Dial(p.uri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rabbitmq connection failed: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("rabbitmq channel creation failed: %w", err)
+	}
+
+	if err := ch.ExchangeDeclare(
+		p.exchange,
+		"topic",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("exchange declare failed: %w", err)
+	}
+
+	confirming, err := newConfirmingChannel(ch, p.confirmTimeout)
+	if err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return conn, confirming, nil
+}
+
+// watch waits for the connection or channel to close and reconnects with backoff, until Close is called.
+func (p *RabbitPublisher) watch(conn *amqp.Connection, ch *confirmingChannel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-p.done:
+			return
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+		select {
+		case <-p.done:
+			return // closed by Close, not lost
+		default:
+		}
+
+		p.setReconnecting()
+		p.logger.Printf("events: rabbitmq connection lost (%v), reconnecting", reason)
+		_ = ch.Close()
+		_ = conn.Close()
+
+		var err error
+		if conn, ch, err = p.reconnect(); err != nil {
+			return // closed while reconnecting
+		}
+		if !p.setConnected(conn, ch) {
+			return // closed right after reconnecting
+		}
+		p.logger.Println("events: rabbitmq reconnected")
+	}
+}
+
+// reconnect dials until it succeeds, doubling the wait between attempts up to reconnectMaxDelay.
+func (p *RabbitPublisher) reconnect() (*amqp.Connection, *confirmingChannel, error) {
+	delay := reconnectBaseDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-p.done:
+			return nil, nil, ErrPublisherClosed
+		case <-time.After(delay):
+		}
+
+		conn, ch, err := p.dial()
+		if err == nil {
+			return conn, ch, nil
+		}
+		p.logger.Printf("events: rabbitmq reconnect attempt %d failed: %v", attempt, err)
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// setConnected switches publishes over to a fresh connection. If Close got in first, Close won't see it, so
+// it's closed here instead and setConnected returns false.
+func (p *RabbitPublisher) setConnected(conn *amqp.Connection, ch PublishingChannel) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		_ = ch.Close()
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return false
+	default:
+	}
+
+	p.conn, p.ch = conn, ch
+	p.state = StateConnected
+	if p.reconnected != nil {
+		close(p.reconnected)
+		p.reconnected = nil
+	}
+	return true
+}
+
+func (p *RabbitPublisher) setReconnecting() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state != StateConnected {
+		return
+	}
+	p.state = StateReconnecting
+	p.reconnected = make(chan struct{})
+}
+
+// channel returns the current channel, waiting while the publisher reconnects.
+func (p *RabbitPublisher) channel(ctx context.Context) (PublishingChannel, error) {
+	for {
+		p.mu.RLock()
+		state, ch, reconnected := p.state, p.ch, p.reconnected
+		p.mu.RUnlock()
+
+		switch state {
+		case StateConnected:
+			return ch, nil
+		case StateClosed:
+			return nil, ErrPublisherClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.done:
+			return nil, ErrPublisherClosed
+		case <-reconnected:
+		}
+	}
+}
+
+// State is the connection state, anything but StateConnected means publishes are waiting.
+func (p *RabbitPublisher) State() ConnState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+func (p *RabbitPublisher) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.state = StateClosed
+		if p.ch != nil {
+			_ = p.ch.Close()
+		}
+		if p.conn != nil {
+			_ = p.conn.Close()
+		}
+	})
+}
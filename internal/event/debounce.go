@@ -0,0 +1,209 @@
+package event
+
+import (
+	"cmp"
+	"cortex-task/internal/article"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const minDebounceTick = 5 * time.Millisecond
+
+// Debounce coalesces the changes to an article that come in quick succession into one event: it's published
+// once the article has gone Window without another change, or MaxDelay after its first one at the latest. A
+// zero Window publishes every change on its own.
+type Debounce struct {
+	Window   time.Duration
+	MaxDelay time.Duration // defaults to, and is at least, Window
+}
+
+func (d Debounce) enabled() bool {
+	return d.Window > 0
+}
+
+// pendingEvent is the coalesced changes to an article waiting for its window to close.
+type pendingEvent struct {
+	event  Event
+	seqs   []uint64
+	tokens []bson.Raw
+	first  time.Time
+	last   time.Time
+}
+
+// debouncer holds events back per article and hands the merged event to the pool when its window closes. The
+// checkpoint can't move past a change that's held back, its position goes to the pool with the merged event.
+type debouncer struct {
+	cfg  Debounce
+	pool *publishPool
+	tick time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	pending map[primitive.ObjectID]*pendingEvent // by document id, like the pool's partitions
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func newDebouncer(cfg Debounce, pool *publishPool) *debouncer {
+	if cfg.MaxDelay < cfg.Window {
+		cfg.MaxDelay = cfg.Window
+	}
+	return &debouncer{
+		cfg:     cfg,
+		pool:    pool,
+		tick:    max(cfg.Window/4, minDebounceTick),
+		now:     time.Now,
+		pending: make(map[primitive.ObjectID]*pendingEvent),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// add holds e back, merged into the article's pending event if it has one. Like pool.reserve it has to be
+// called in stream order from one goroutine.
+func (d *debouncer) add(e Event, token bson.Raw) {
+	seq := d.pool.reserve()
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.pending[e.DocumentID]
+	if !ok {
+		d.pending[e.DocumentID] = &pendingEvent{
+			event:  e,
+			seqs:   []uint64{seq},
+			tokens: []bson.Raw{copyToken(token)},
+			first:  now,
+			last:   now,
+		}
+		return
+	}
+	p.event = mergeEvents(p.event, e)
+	p.seqs = append(p.seqs, seq)
+	p.tokens = append(p.tokens, copyToken(token))
+	p.last = now
+}
+
+func (d *debouncer) start() {
+	go func() {
+		defer close(d.done)
+
+		t := time.NewTicker(d.tick)
+		defer t.Stop()
+		for {
+			select {
+			case <-d.stopCh:
+				return
+			case <-t.C:
+				d.flush()
+			}
+		}
+	}()
+}
+
+// stop drops whatever is still pending, it was never checkpointed so it's published again after a restart.
+func (d *debouncer) stop() {
+	close(d.stopCh)
+	<-d.done
+}
+
+// flush submits the events whose window has closed, oldest first.
+func (d *debouncer) flush() {
+	now := d.now()
+
+	d.mu.Lock()
+	var due []*pendingEvent
+	for id, p := range d.pending {
+		if now.Sub(p.last) >= d.cfg.Window || now.Sub(p.first) >= d.cfg.MaxDelay {
+			due = append(due, p)
+			delete(d.pending, id)
+		}
+	}
+	d.mu.Unlock()
+
+	slices.SortFunc(due, func(a, b *pendingEvent) int { return cmp.Compare(a.seqs[0], b.seqs[0]) })
+	for _, p := range due {
+		e := p.event
+		d.pool.submitJob(poolJob{seqs: p.seqs, tokens: p.tokens, event: &e})
+	}
+}
+
+// mergeEvents is what newer looks like coalesced with the older change before it: the latest article state,
+// every field either of them changed, and a type that still tells consumers what happened overall. an article
+// created in the window is still created, a deleted one is deleted, and an update only counts as a media update
+// when both were.
+func mergeEvents(older, newer Event) Event {
+	merged := newer
+	switch {
+	case newer.Type == ArticleDeleted:
+	case older.Type == ArticleCreated:
+		merged.Type = ArticleCreated
+	case older.Type == ArticleUpdated:
+		merged.Type = ArticleUpdated
+	}
+	if merged.ExternalID == 0 {
+		merged.ExternalID = older.ExternalID
+	}
+	if merged.Type == ArticleDeleted {
+		return merged
+	}
+
+	merged.Changes = mergeChanges(older.Changes, newer.Changes)
+
+	merged.Updated = nil
+	removed := make([]string, 0, len(older.Removed)+len(newer.Removed))
+	for field, value := range older.Updated {
+		if !slices.Contains(newer.Removed, field) {
+			merged.Updated = setUpdated(merged.Updated, field, value)
+		}
+	}
+	for _, field := range older.Removed {
+		if _, ok := newer.Updated[field]; !ok {
+			removed = append(removed, field)
+		}
+	}
+	for field, value := range newer.Updated {
+		merged.Updated = setUpdated(merged.Updated, field, value)
+	}
+	for _, field := range newer.Removed {
+		if !slices.Contains(removed, field) {
+			removed = append(removed, field)
+		}
+	}
+	merged.Removed = nil
+	if len(removed) > 0 {
+		merged.Removed = removed
+	}
+	return merged
+}
+
+func setUpdated(updated map[string]any, field string, value any) map[string]any {
+	if updated == nil {
+		updated = make(map[string]any)
+	}
+	updated[field] = value
+	return updated
+}
+
+// mergeChanges keeps one change per field, from its value before the first change to its value after the last.
+func mergeChanges(older, newer []article.FieldChange) []article.FieldChange {
+	if len(older) == 0 {
+		return newer
+	}
+	merged := slices.Clone(older)
+	for _, c := range newer {
+		i := slices.IndexFunc(merged, func(m article.FieldChange) bool { return m.Field == c.Field })
+		if i < 0 {
+			merged = append(merged, c)
+			continue
+		}
+		merged[i].New = c.New
+	}
+	return merged
+}
@@ -0,0 +1,91 @@
+package event
+
+import (
+	"cortex-task/internal/article"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventType string
+
+// Each event type is published with its own routing key, see RabbitPublisher.
+const (
+	ArticleCreated      EventType = "article.created"
+	ArticleUpdated      EventType = "article.updated"
+	ArticleMediaUpdated EventType = "article.media.updated" // only the lead media changed
+	ArticleDeleted      EventType = "article.deleted"
+)
+
+// Event is a single article change to publish.
+type Event struct {
+	Type       EventType
+	DocumentID primitive.ObjectID
+	ExternalID int64 // 0 for a delete when the change stream has no pre-image to read it from
+	Changes    []article.FieldChange
+	Article    *article.Article // nil for deletes
+	Updated    map[string]any   // new value of each changed field by bson path, for delta payloads
+	Removed    []string
+}
+
+// bookkeepingFields are written with every update and say nothing about what changed in the article.
+var bookkeepingFields = map[string]struct{}{
+	"lastChanges": {},
+	"modifiedAt":  {},
+	"revision":    {},
+}
+
+// eventType maps a write to the event it's published as. op is a change stream operation type or an
+// article.ChangeOp, fields are the dotted paths it changed. an update that changed nothing but the lead media
+// is a media update, an update without any known fields (a replace, a manual edit) is a plain update.
+func eventType(op string, fields []string) EventType {
+	switch op {
+	case "insert":
+		return ArticleCreated
+	case "delete":
+		return ArticleDeleted
+	}
+
+	media := false
+	for _, f := range fields {
+		if _, ok := bookkeepingFields[f]; ok {
+			continue
+		}
+		if f != "leadMedia" && !strings.HasPrefix(f, "leadMedia.") {
+			return ArticleUpdated
+		}
+		media = true
+	}
+	if media {
+		return ArticleMediaUpdated
+	}
+	return ArticleUpdated
+}
+
+// changedFields lists the paths in changes.
+func changedFields(changes []article.FieldChange) []string {
+	fields := make([]string, 0, len(changes))
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+// articleEvent builds the event for a write of a described by changes, used where the write comes with a
+// list of changes rather than a change stream updateDescription.
+func articleEvent(op string, a *article.Article, changes []article.FieldChange) Event {
+	e := Event{
+		Type:       eventType(op, changedFields(changes)),
+		DocumentID: a.ID,
+		ExternalID: a.ExternalID,
+		Changes:    changes,
+		Article:    a,
+	}
+	if len(changes) > 0 {
+		e.Updated = make(map[string]any, len(changes))
+		for _, c := range changes {
+			e.Updated[c.Field] = c.New
+		}
+	}
+	return e
+}
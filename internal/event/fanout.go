@@ -0,0 +1,239 @@
+package event
+
+import (
+	"context"
+	"cortex-task/internal/spool"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// RetryPolicy is how a sink retries an event its publisher failed: BaseDelay doubles after every attempt up to
+// MaxDelay. The event is retried until it goes through, the events behind it wait.
+type RetryPolicy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	d := r.BaseDelay
+	for i := 1; i < attempt && d < r.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, r.MaxDelay)
+}
+
+// Sink is one destination of a FanoutPublisher, with a spool of its own for the events it hasn't published yet.
+type Sink struct {
+	Name      string
+	Publisher Publisher
+	Spool     *spool.Spool
+	Retry     RetryPolicy // defaults to DefaultRetryPolicy
+}
+
+// SinkHealth is a snapshot of how a sink is doing.
+type SinkHealth struct {
+	Name        string    `json:"name"`
+	Healthy     bool      `json:"healthy"`
+	Queued      int       `json:"queued"`
+	Failures    int       `json:"failures"` // attempts failed in a row
+	LastError   string    `json:"lastError,omitempty"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+}
+
+type sink struct {
+	Sink
+	wake chan struct{}
+
+	mu          sync.Mutex
+	failures    int
+	lastError   string
+	lastSuccess time.Time
+}
+
+// FanoutPublisher sends every event to each of its sinks through a spool on disk of its own, a worker per sink
+// publishes and retries from it. A slow or broken sink only holds up its own spool, not the other sinks or the
+// event source, and events still spooled when the process stops are published after the restart.
+type FanoutPublisher struct {
+	sinks  []*sink
+	logger *log.Logger
+}
+
+func NewFanoutPublisher(sinks []Sink, logger *log.Logger) *FanoutPublisher {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	p := &FanoutPublisher{logger: logger}
+	for _, s := range sinks {
+		if s.Retry.BaseDelay <= 0 {
+			s.Retry = DefaultRetryPolicy
+		}
+		p.sinks = append(p.sinks, &sink{Sink: s, wake: make(chan struct{}, 1)})
+	}
+	return p
+}
+
+// Publish appends e to the spool of every sink and only returns nil once all of them have it, so the event
+// source never checkpoints an event a sink could lose. The error joins the sinks whose spool is full or can't
+// be written, publishing again appends e to the others a second time.
+func (p *FanoutPublisher) Publish(_ context.Context, e Event) error {
+	rec, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range p.sinks {
+		if err := s.Spool.Append(rec); err != nil {
+			s.failed(err)
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name, err))
+			continue
+		}
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run publishes spooled events to every sink until ctx is cancelled.
+func (p *FanoutPublisher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range p.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.runSink(ctx, s)
+		}()
+	}
+	wg.Wait()
+
+	for _, s := range p.sinks {
+		if n := s.Spool.Len(); n > 0 {
+			p.logger.Printf("events: stopped with %d events spooled for sink %s, they're published after the restart", n, s.Name)
+		}
+	}
+}
+
+func (p *FanoutPublisher) runSink(ctx context.Context, s *sink) {
+	t := time.NewTicker(spoolCheckInterval)
+	defer t.Stop()
+
+	if n := s.Spool.Len(); n > 0 {
+		p.logger.Printf("events: %d spooled events waiting for sink %s", n, s.Name)
+	}
+
+	for {
+		p.drainSink(ctx, s)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// drainSink publishes the events spooled for s oldest first, an event is only removed from the spool once it's
+// published.
+func (p *FanoutPublisher) drainSink(ctx context.Context, s *sink) {
+	for ctx.Err() == nil {
+		rec, err := s.Spool.Peek()
+		if errors.Is(err, spool.ErrEmpty) {
+			return
+		}
+		if err != nil {
+			s.failed(err)
+			p.logger.Printf("events: sink %s failed reading its spool: %v", s.Name, err)
+			return
+		}
+
+		e, err := decodeSpooled(rec)
+		if err != nil {
+			// it'll never decode, retrying would block the sink for good
+			p.logger.Printf("events: sink %s dropping unreadable spooled event: %v", s.Name, err)
+		} else if !p.publishToSink(ctx, s, e) {
+			return
+		}
+
+		if err := s.Spool.Ack(); err != nil {
+			s.failed(err)
+			p.logger.Printf("events: sink %s failed acknowledging a spooled event: %v", s.Name, err)
+			return
+		}
+	}
+}
+
+// publishToSink retries e on s with backoff until it's published, false means ctx was cancelled first.
+func (p *FanoutPublisher) publishToSink(ctx context.Context, s *sink, e Event) bool {
+	for attempt := 1; ; attempt++ {
+		err := s.Publisher.Publish(ctx, e)
+		if err == nil {
+			s.succeeded()
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		s.failed(err)
+
+		delay := s.Retry.delay(attempt)
+		p.logger.Printf("events: sink %s failed publishing %s for %d (attempt %d), retrying in %v: %v",
+			s.Name, e.Type, e.ExternalID, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Health reports on every sink, a sink is healthy when its last attempt succeeded and its publisher, if it
+// can tell, is connected.
+func (p *FanoutPublisher) Health() []SinkHealth {
+	health := make([]SinkHealth, 0, len(p.sinks))
+	for _, s := range p.sinks {
+		health = append(health, s.health())
+	}
+	return health
+}
+
+func (s *sink) health() SinkHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy := s.failures == 0
+	if hr, ok := s.Publisher.(healthReporter); ok && hr.State() != StateConnected {
+		healthy = false
+	}
+	return SinkHealth{
+		Name:        s.Name,
+		Healthy:     healthy,
+		Queued:      s.Spool.Len(),
+		Failures:    s.failures,
+		LastError:   s.lastError,
+		LastSuccess: s.lastSuccess,
+	}
+}
+
+func (s *sink) succeeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+	s.lastSuccess = time.Now()
+}
+
+func (s *sink) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	s.lastError = err.Error()
+}
@@ -0,0 +1,42 @@
+package event
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// FilePublisher appends every event to a file as a line of JSON, in the newest schema version of the message
+// format. It's meant as a local audit log of what was published, not something to consume from.
+type FilePublisher struct {
+	mu     sync.Mutex
+	f      *os.File
+	format MessageFormat
+}
+
+func NewFilePublisher(path string, format MessageFormat) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{f: f, format: format}, nil
+}
+
+func (p *FilePublisher) Publish(_ context.Context, e Event) error {
+	body, _, err := newestMessageBody(e, p.format, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.f.Write(append(body, '\n'))
+	return err
+}
+
+func (p *FilePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.f.Close()
+}
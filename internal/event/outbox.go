@@ -0,0 +1,254 @@
+package event
+
+import (
+	"context"
+	"cortex-task/internal/article"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultRelayBatchSize = 100
+	defaultRelayLease     = time.Minute // a crashed relay's claim is taken over after this
+
+	relayBaseBackoff = time.Second
+	relayMaxBackoff  = 5 * time.Minute
+)
+
+// OutboxRelay publishes the records the outbox repository writes next to every article change. Records are
+// published strictly in the order they were written: a record that fails is retried with backoff and holds
+// back everything after it until it succeeds. Only a record that can never be published, one that can't be
+// encoded, is marked failed and skipped.
+//
+// Every replica runs a relay. A record is claimed before it's published, and only the oldest record that isn't
+// done can be claimed, so while one relay works through the records the others wait instead of publishing them
+// twice or out of order. The claim is renewed for as long as the publish takes.
+//
+// Delivery is at-least-once, a crash between publishing and marking the record done publishes it again.
+type OutboxRelay struct {
+	col       *mongo.Collection
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	owner     string
+	lease     time.Duration
+	logger    *log.Logger
+}
+
+func NewOutboxRelay(db *mongo.Database, publisher Publisher, interval time.Duration, logger *log.Logger) *OutboxRelay {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	host, _ := os.Hostname()
+	return &OutboxRelay{
+		col:       db.Collection(article.OutboxCollection),
+		publisher: publisher,
+		interval:  interval,
+		batchSize: defaultRelayBatchSize,
+		owner:     fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+		lease:     defaultRelayLease,
+		logger:    logger,
+	}
+}
+
+// Run relays pending records every interval until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	r.logger.Printf("events: relaying %s every %v...", article.OutboxCollection, r.interval)
+
+	for {
+		// keep going while full batches come back so a backlog drains without waiting for the ticker
+		n, err := r.RunOnce(ctx)
+		if err != nil {
+			r.logger.Printf("events: outbox relay failed: %v", err)
+		}
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Println("events: outbox relay stopped")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce publishes the next batch of pending records and returns how many were published. It stops at the
+// first record another relay holds a live claim on.
+func (r *OutboxRelay) RunOnce(ctx context.Context) (int, error) {
+	cur, err := r.col.Find(ctx,
+		bson.M{"status": bson.M{"$in": bson.A{article.OutboxPending, article.OutboxPublishing}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(r.batchSize)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var records []article.OutboxRecord
+	if err := cur.All(ctx, &records); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, rec := range records {
+		now := time.Now()
+		if rec.NextAttemptAt.After(now) {
+			return published, nil // still backing off, later records wait for it
+		}
+		claimed, err := r.claim(ctx, rec, now)
+		if err != nil || !claimed {
+			return published, err // another relay is publishing it, and the records after it
+		}
+
+		a := rec.Article
+		a.LastChanges = rec.Changes
+		e := articleEvent(string(rec.Op), &a, rec.Changes)
+		if err := r.publish(ctx, rec, e); err != nil {
+			if ctx.Err() != nil {
+				return published, ctx.Err()
+			}
+			if errors.Is(err, errLeaseLost) {
+				return published, err // whoever took it over publishes it
+			}
+			return published, r.markFailed(ctx, rec, err, now)
+		}
+
+		if _, err := r.col.UpdateByID(ctx, rec.ID, bson.M{
+			"$set":   bson.M{"status": article.OutboxDone, "publishedAt": now},
+			"$unset": bson.M{"owner": "", "leaseUntil": ""},
+		}); err != nil {
+			return published, err
+		}
+		published++
+		r.logger.Printf("events: published %s for article %d revision %d from outbox", e.Type, rec.ExternalID, rec.Revision)
+	}
+	return published, nil
+}
+
+// errLeaseLost cancels a publish whose claim couldn't be renewed.
+var errLeaseLost = errors.New("event: outbox lease lost")
+
+// publish publishes e while renewing the claim on rec every third of the lease. If a renewal fails the
+// publish is cancelled, another relay may take the record over once the lease runs out.
+func (r *OutboxRelay) publish(ctx context.Context, rec article.OutboxRecord, e Event) error {
+	pubCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+
+		t := time.NewTicker(r.lease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-pubCtx.Done():
+				return
+			case <-t.C:
+			}
+			if err := r.renew(pubCtx, rec); err != nil {
+				r.logger.Printf("events: cancelling publish of outbox record %s: %v", rec.ID.Hex(), err)
+				cancel(err)
+				return
+			}
+		}
+	}()
+
+	err := r.publisher.Publish(pubCtx, e)
+	close(done)
+	<-renewed
+	if cause := context.Cause(pubCtx); err != nil && errors.Is(cause, errLeaseLost) {
+		return cause
+	}
+	return err
+}
+
+// renew extends our claim on rec.
+func (r *OutboxRelay) renew(ctx context.Context, rec article.OutboxRecord) error {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": rec.ID, "status": article.OutboxPublishing, "owner": r.owner},
+		bson.M{"$set": bson.M{"leaseUntil": time.Now().Add(r.lease)}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLeaseLost, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: taken over by another relay", errLeaseLost)
+	}
+	return nil
+}
+
+// claim atomically marks rec as being published by this relay, if it's pending, its claim is ours or the
+// relay that claimed it let the lease run out. rec is the head of the outbox as read by RunOnce, so claiming it
+// fails once another relay got to it first.
+func (r *OutboxRelay) claim(ctx context.Context, rec article.OutboxRecord, now time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{
+			"_id": rec.ID,
+			"$or": bson.A{
+				bson.M{"status": article.OutboxPending},
+				bson.M{"status": article.OutboxPublishing, "owner": r.owner},
+				bson.M{"status": article.OutboxPublishing, "leaseUntil": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"status":     article.OutboxPublishing,
+			"owner":      r.owner,
+			"leaseUntil": now.Add(r.lease),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
+	}
+	if rec.Status == article.OutboxPublishing && rec.Owner != r.owner {
+		r.logger.Printf("events: took over outbox record %s for article %d, the lease of %s ran out", rec.ID.Hex(), rec.ExternalID, rec.Owner)
+	}
+	return true, nil
+}
+
+// markFailed schedules the next attempt for rec, or gives up on it when it can't be encoded. Any other error,
+// a broker that's down for however long, is retried.
+func (r *OutboxRelay) markFailed(ctx context.Context, rec article.OutboxRecord, cause error, now time.Time) error {
+	attempts := rec.Attempts + 1
+	set := bson.M{
+		"status":        article.OutboxPending,
+		"attempts":      attempts,
+		"lastError":     cause.Error(),
+		"nextAttemptAt": now.Add(relayBackoff(attempts)),
+	}
+	if errors.Is(cause, ErrUnencodable) {
+		set["status"] = article.OutboxFailed
+		r.logger.Printf("events: giving up on outbox record %s for article %d, it can't be published: %v", rec.ID.Hex(), rec.ExternalID, cause)
+	} else {
+		r.logger.Printf("events: failed publishing article %d from outbox (attempt %d): %v", rec.ExternalID, attempts, cause)
+	}
+
+	_, err := r.col.UpdateByID(ctx, rec.ID, bson.M{"$set": set, "$unset": bson.M{"owner": "", "leaseUntil": ""}})
+	return err
+}
+
+// relayBackoff doubles the wait after each failed attempt, up to relayMaxBackoff.
+func relayBackoff(attempts int) time.Duration {
+	d := relayBaseBackoff
+	for i := 1; i < attempts && d < relayMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, relayMaxBackoff)
+}
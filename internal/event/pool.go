@@ -0,0 +1,144 @@
+package event
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const workerQueueSize = 64
+
+// poolJob is an event with the stream positions it stands for and the resume token after each, more than one
+// when changes were coalesced into it. A nil event is only checkpointed.
+type poolJob struct {
+	seqs   []uint64
+	tokens []bson.Raw
+	event  *Event
+}
+
+// publishPool publishes events on a number of workers. Events are partitioned by article so changes to the same
+// article are published in the order they happened while different articles are published in parallel.
+//
+// The resume token of an event is only checkpointed once it and every event before it are published, so a
+// restart never skips an event that was still waiting. publish retries until it succeeds, an event it gives up
+// on (on shutdown) is never done and nothing after it is checkpointed, it's published again after the restart.
+type publishPool struct {
+	workers    []chan poolJob
+	completed  chan poolJob
+	publish    func(ctx context.Context, e Event) bool
+	checkpoint func(token bson.Raw)
+	seq        uint64
+
+	wg      sync.WaitGroup
+	tracked chan struct{}
+}
+
+func newPublishPool(size int, publish func(context.Context, Event) bool, checkpoint func(bson.Raw)) *publishPool {
+	size = max(size, 1)
+	p := &publishPool{
+		workers:    make([]chan poolJob, size),
+		completed:  make(chan poolJob, size*workerQueueSize),
+		publish:    publish,
+		checkpoint: checkpoint,
+		tracked:    make(chan struct{}),
+	}
+	for i := range p.workers {
+		p.workers[i] = make(chan poolJob, workerQueueSize)
+	}
+	return p
+}
+
+func (p *publishPool) start(ctx context.Context) {
+	for _, jobs := range p.workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range jobs {
+				if !p.publish(ctx, *job.event) {
+					continue
+				}
+				p.completed <- job
+			}
+		}()
+	}
+	go p.track()
+}
+
+// reserve hands out the position of the next change read from the stream, positions have to be reserved in
+// stream order by a single goroutine.
+func (p *publishPool) reserve() uint64 {
+	seq := p.seq
+	p.seq++
+	return seq
+}
+
+// submit queues e on its article's worker, blocking while that worker is full. A nil e skips a change that has
+// nothing to publish but still has to be checkpointed in order.
+func (p *publishPool) submit(e *Event, token bson.Raw) {
+	p.submitJob(poolJob{seqs: []uint64{p.reserve()}, tokens: []bson.Raw{copyToken(token)}, event: e})
+}
+
+func (p *publishPool) submitJob(job poolJob) {
+	if job.event == nil {
+		p.completed <- job
+		return
+	}
+	p.workers[partition(job.event.DocumentID, len(p.workers))] <- job
+}
+
+// stop waits for the queued events to be published and the last checkpoint to be saved.
+func (p *publishPool) stop() {
+	for _, jobs := range p.workers {
+		close(jobs)
+	}
+	p.wg.Wait()
+	close(p.completed)
+	<-p.tracked
+}
+
+// track checkpoints the token of the newest event that has every event before it done.
+func (p *publishPool) track() {
+	defer close(p.tracked)
+
+	var (
+		next uint64
+		done = make(map[uint64]bson.Raw) // finished events after next
+	)
+	for job := range p.completed {
+		for i, seq := range job.seqs {
+			done[seq] = job.tokens[i]
+		}
+
+		var token bson.Raw
+		for {
+			t, ok := done[next]
+			if !ok {
+				break
+			}
+			delete(done, next)
+			next++
+			if t != nil {
+				token = t
+			}
+		}
+		if token != nil {
+			p.checkpoint(token)
+		}
+	}
+}
+
+// partition picks the worker of an article by its document id. It maps one to one to the externalId, and
+// deletes without a pre-image only have the document id, so all the changes to an article share a worker.
+func partition(id primitive.ObjectID, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(id[:])
+	return int(h.Sum32() % uint32(n))
+}
+
+// copyToken keeps our own copy of a resume token, the driver hands out the token of the current event.
+func copyToken(token bson.Raw) bson.Raw {
+	return append(bson.Raw(nil), token...)
+}
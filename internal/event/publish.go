@@ -4,17 +4,98 @@ import (
 	"context"
 	"cortex-task/internal/article"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type PayloadMode string
+
+// How much of the article created and updated events carry.
+const (
+	PayloadFull      PayloadMode = "full"      // the whole article, ArticleUpdatedMessage
+	PayloadDelta     PayloadMode = "delta"     // ids and the changed fields, ArticleDeltaMessage
+	PayloadReference PayloadMode = "reference" // ids only, ArticleReferenceMessage
+)
+
+// Headers on every published message, the message id is the event's id.
+const (
+	HeaderEventType     = "event-type"
+	HeaderSchemaVersion = "schema-version"
+	HeaderArticleType   = "article-type"
+	HeaderLanguage      = "language"
+)
+
+// ArticleUpdatedMessage is the body of article.created, article.updated and article.media.updated events.
 type ArticleUpdatedMessage struct {
-	Event     string          `json:"event"`
-	Timestamp time.Time       `json:"timestamp"`
-	Article   article.Article `json:"article"`
+	Event     string                `json:"event"`
+	Timestamp time.Time             `json:"timestamp"`
+	Changes   []article.FieldChange `json:"changes,omitempty"` // fields touched by the last update, empty on insert
+	Article   ArticleV1             `json:"article"`
+}
+
+// ArticleV1 is the article in version 1 messages. It keeps the Go field names they've always had, the json tags
+// of article.Article are the camelCase of the HTTP API.
+type ArticleV1 struct {
+	ID           primitive.ObjectID
+	ExternalID   int64
+	Type         string
+	Title        string
+	Description  string
+	Date         time.Time
+	Location     string
+	Language     string
+	CanonicalURL string
+	LastModified time.Time
+	Body         string
+	Summary      string
+	Tags         []string
+	LeadMedia    LeadMediaV1
+	CreatedAt    time.Time
+	ModifiedAt   time.Time
+	Revision     int
+	LastChanges  []article.FieldChange
+}
+
+type LeadMediaV1 struct {
+	ID           int64
+	Type         string
+	Title        string
+	Date         time.Time
+	Language     string
+	ImageURL     string
+	LastModified time.Time
+}
+
+// ArticleDeletedMessage is the body of article.deleted events, the article itself is gone.
+type ArticleDeletedMessage struct {
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+	DocumentID string    `json:"documentId"`
+	ExternalID int64     `json:"externalId,omitempty"` // only known when the change stream has pre-images
+}
+
+// ArticleReferenceMessage identifies the article that changed, consumers fetch it from GET /articles/{externalId}
+// and can use lastModified and revision to tell whether they already have this version.
+type ArticleReferenceMessage struct {
+	Event        string    `json:"event"`
+	Timestamp    time.Time `json:"timestamp"`
+	DocumentID   string    `json:"documentId"`
+	ExternalID   int64     `json:"externalId"`
+	LastModified time.Time `json:"lastModified"`
+	Revision     int       `json:"revision"`
+}
+
+// ArticleDeltaMessage is a reference plus the new value of every changed field, keyed by its bson path.
+type ArticleDeltaMessage struct {
+	ArticleReferenceMessage
+	Updated map[string]any `json:"updated,omitempty"`
+	Removed []string       `json:"removed,omitempty"`
 }
 
 type PublishingChannel interface {
@@ -28,77 +109,240 @@ type PublishingChannel interface {
 }
 
 type RabbitPublisher struct {
-	conn       *amqp.Connection
-	ch         PublishingChannel
+	uri            string
+	confirmTimeout time.Duration
+
+	mu          sync.RWMutex
+	conn        *amqp.Connection
+	ch          PublishingChannel
+	state       ConnState
+	reconnected chan struct{} // closed once the connection is back, replaced every time it's lost
+	done        chan struct{} // closed by Close
+	closeOnce   sync.Once
+
 	exchange   string
-	routingKey string
+	routingKey string              // used for article.updated, the other events are routed by their type
+	keys       *RoutingKeyTemplate // replaces both when set
+	format     MessageFormat
+	retryDelay time.Duration
 	logger     *log.Logger
 }
 
-func NewRabbitPublisher(uri, exchange, routingKey string, logger *log.Logger) (*RabbitPublisher, error) {
-	conn, err := amqp.Dial(uri)
-	if err != nil {
-		return nil, fmt.Errorf("rabbitmq connection failed: %w", err)
+// NewRabbitPublisher puts the channel in confirm mode, a publish is only successful once the broker acked it
+// within confirmTimeout. nacked and unconfirmed messages are retried with backoff before giving up.
+//
+// The first connection has to succeed, after that a lost connection or channel is re-established in the
+// background and publishes wait for it (up to their ctx) instead of failing.
+//
+// With a routingTemplate every event is routed by the key it builds, see RoutingKeyTemplate. Without one
+// article.updated goes to routingKey and the other events to their type.
+func NewRabbitPublisher(
+	uri, exchange, routingKey, routingTemplate string,
+	format MessageFormat,
+	confirmTimeout time.Duration,
+	logger *log.Logger,
+) (*RabbitPublisher, error) {
+	if logger == nil {
+		logger = log.Default()
 	}
 
-	ch, err := conn.Channel()
+	p := &RabbitPublisher{
+		uri:            uri,
+		confirmTimeout: confirmTimeout,
+		done:           make(chan struct{}),
+		exchange:       exchange,
+		routingKey:     routingKey,
+		format:         format,
+		retryDelay:     publishRetryDelay,
+		logger:         logger,
+	}
+
+	if routingTemplate != "" {
+		keys, err := ParseRoutingKeyTemplate(routingTemplate)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+	}
+
+	conn, ch, err := p.dial()
 	if err != nil {
-		_ = conn.Close()
-		return nil, fmt.Errorf("rabbitmq channel creation failed: %w", err)
+		return nil, err
 	}
+	p.setConnected(conn, ch)
+	go p.watch(conn, ch)
+
+	return p, nil
+}
 
-	if err := ch.ExchangeDeclare(
-		exchange,
-		"topic",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	); err != nil {
-		_ = ch.Close()
-		_ = conn.Close()
-		return nil, fmt.Errorf("exchange declare failed: %w", err)
+// PublishArticleUpdated publishes a as an article.updated event.
+func (p *RabbitPublisher) PublishArticleUpdated(ctx context.Context, a *article.Article) error {
+	return p.Publish(ctx, Event{
+		Type:       ArticleUpdated,
+		DocumentID: a.ID,
+		ExternalID: a.ExternalID,
+		Changes:    a.LastChanges,
+		Article:    a,
+	})
+}
+
+// ErrUnencodable wraps the errors of events that can't be turned into a message, retrying them never helps.
+var ErrUnencodable = errors.New("event: can't be encoded")
+
+// Publish sends e once for every schema version in the message format, a failure part way through means
+// the versions before it are published again when the event is retried.
+func (p *RabbitPublisher) Publish(ctx context.Context, e Event) error {
+	now := time.Now().UTC()
+	for _, version := range p.format.versions() {
+		var (
+			body        []byte
+			contentType = "application/json"
+			key         = p.routingKeyFor(e)
+			err         error
+		)
+		switch version {
+		case SchemaV1:
+			body, err = messageBody(e, p.format.Payload, now)
+		case SchemaV2:
+			body, err = cloudEventBody(e, p.format, now)
+			contentType = cloudEventsContentType
+			key = "v2." + key
+		default:
+			err = fmt.Errorf("event: unknown schema version %d", version)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUnencodable, err)
+		}
+
+		if err := p.publish(ctx, key, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  contentType,
+			MessageId:    eventID(e),
+			Type:         string(e.Type),
+			Timestamp:    now,
+			Headers:      messageHeaders(e, version),
+			Body:         body,
+		}); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// publish retries messages the broker nacked or didn't confirm, or that hit a closed channel. any other error
+// is returned straight away.
+func (p *RabbitPublisher) publish(ctx context.Context, key string, msg amqp.Publishing) error {
+	delay := p.retryDelay
+	for attempt := 1; ; attempt++ {
+		ch, err := p.channel(ctx)
+		if err != nil {
+			return err
+		}
 
-	return &RabbitPublisher{
-		conn:       conn,
-		ch:         ch,
-		exchange:   exchange,
-		routingKey: routingKey,
-		logger:     logger,
-	}, nil
+		// a closed channel is retried too, by then the watcher has usually noticed and the next attempt waits
+		// for it to reconnect
+		err = ch.PublishWithContext(ctx, p.exchange, key, false, false, msg)
+		if err == nil || !publishRetryable(err) || attempt == maxPublishAttempts {
+			return err
+		}
+
+		p.logger.Printf("events: publish to %s failed (attempt %d), retrying in %v: %v", key, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
 }
 
-func (p *RabbitPublisher) Close() {
-	if p.ch != nil {
-		_ = p.ch.Close()
+// messageHeaders let consumers filter and dedupe without parsing the body, the article ones are left out of
+// deletes as the article is gone.
+func messageHeaders(e Event, version int) amqp.Table {
+	h := amqp.Table{
+		HeaderEventType:     string(e.Type),
+		HeaderSchemaVersion: int32(version),
 	}
-	if p.conn != nil {
-		_ = p.conn.Close()
+	if e.Article != nil {
+		h[HeaderArticleType] = e.Article.Type
+		h[HeaderLanguage] = e.Article.Language
 	}
+	return h
 }
 
-func (p *RabbitPublisher) PublishArticleUpdated(ctx context.Context, a *article.Article) error {
-	body, err := json.Marshal(ArticleUpdatedMessage{
-		Event:     "article.updated",
-		Timestamp: time.Now().UTC(),
-		Article:   *a,
-	})
-	if err != nil {
-		return err
+// routingKeyFor keeps article.updated on the configured routing key so existing bindings still receive it,
+// unless there's a template.
+func (p *RabbitPublisher) routingKeyFor(e Event) string {
+	if p.keys != nil {
+		return p.keys.Key(e)
+	}
+	if e.Type == ArticleUpdated {
+		return p.routingKey
 	}
+	return string(e.Type)
+}
 
-	return p.ch.PublishWithContext(
-		ctx,
-		p.exchange,
-		p.routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/json",
-			Body:         body,
-		},
-	)
+// messageBody encodes e in the shape of its event type and payload mode. deletes look the same in every
+// mode, an empty mode is PayloadFull.
+func messageBody(e Event, mode PayloadMode, now time.Time) ([]byte, error) {
+	if e.Type == ArticleDeleted {
+		return json.Marshal(ArticleDeletedMessage{
+			Event:      string(e.Type),
+			Timestamp:  now,
+			DocumentID: e.DocumentID.Hex(),
+			ExternalID: e.ExternalID,
+		})
+	}
+	if e.Article == nil {
+		return nil, fmt.Errorf("event: %s for %d has no article", e.Type, e.ExternalID)
+	}
+
+	ref := ArticleReferenceMessage{
+		Event:        string(e.Type),
+		Timestamp:    now,
+		DocumentID:   e.DocumentID.Hex(),
+		ExternalID:   e.ExternalID,
+		LastModified: e.Article.LastModified,
+		Revision:     e.Article.Revision,
+	}
+	switch mode {
+	case PayloadReference:
+		return json.Marshal(ref)
+	case PayloadDelta:
+		return json.Marshal(ArticleDeltaMessage{
+			ArticleReferenceMessage: ref,
+			Updated:                 e.Updated,
+			Removed:                 e.Removed,
+		})
+	}
+
+	return json.Marshal(ArticleUpdatedMessage{
+		Event:     string(e.Type),
+		Timestamp: now,
+		Changes:   e.Changes,
+		Article:   newArticleV1(e.Article),
+	})
+}
+
+func newArticleV1(a *article.Article) ArticleV1 {
+	return ArticleV1{
+		ID:           a.ID,
+		ExternalID:   a.ExternalID,
+		Type:         a.Type,
+		Title:        a.Title,
+		Description:  a.Description,
+		Date:         a.Date,
+		Location:     a.Location,
+		Language:     a.Language,
+		CanonicalURL: a.CanonicalURL,
+		LastModified: a.LastModified,
+		Body:         a.Body,
+		Summary:      a.Summary,
+		Tags:         a.Tags,
+		LeadMedia:    LeadMediaV1(a.LeadMedia),
+		CreatedAt:    a.CreatedAt,
+		ModifiedAt:   a.ModifiedAt,
+		Revision:     a.Revision,
+		LastChanges:  a.LastChanges,
+	}
 }
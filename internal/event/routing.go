@@ -0,0 +1,74 @@
+package event
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unknownKeyWord stands in for an attribute a delete doesn't have, the article is gone.
+const unknownKeyWord = "unknown"
+
+var placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// routingKeyFields are the placeholders a RoutingKeyTemplate can use, each fills exactly one word of the key so
+// topic bindings can match it with *.
+var routingKeyFields = map[string]func(e Event) string{
+	"event": func(e Event) string {
+		// article.media.updated -> media_updated
+		return strings.TrimPrefix(string(e.Type), "article.")
+	},
+	"language": func(e Event) string {
+		if e.Article == nil {
+			return ""
+		}
+		return e.Article.Language
+	},
+	"type": func(e Event) string {
+		if e.Article == nil {
+			return ""
+		}
+		return e.Article.Type
+	},
+}
+
+// RoutingKeyTemplate builds a routing key from event and article attributes, e.g. article.{event}.{language}.{type}
+// routes an English match report update as article.updated.en.match.
+type RoutingKeyTemplate struct {
+	template string
+}
+
+// ParseRoutingKeyTemplate checks every placeholder in template is one of {event}, {language} and {type}.
+func ParseRoutingKeyTemplate(template string) (*RoutingKeyTemplate, error) {
+	for _, m := range placeholderRe.FindAllStringSubmatch(template, -1) {
+		if _, ok := routingKeyFields[m[1]]; !ok {
+			return nil, fmt.Errorf("event: unknown routing key placeholder %s in %q, expected {event}, {language} or {type}", m[0], template)
+		}
+	}
+	if strings.ContainsAny(placeholderRe.ReplaceAllString(template, ""), "{}") {
+		return nil, fmt.Errorf("event: unbalanced braces in routing key template %q", template)
+	}
+	return &RoutingKeyTemplate{template: template}, nil
+}
+
+// Key fills the template in for e. Values are lower cased and anything that would split or wildcard a topic word
+// (dots, spaces, * and #) becomes an underscore, a missing value is "unknown".
+func (t *RoutingKeyTemplate) Key(e Event) string {
+	return placeholderRe.ReplaceAllStringFunc(t.template, func(placeholder string) string {
+		return routingKeyWord(routingKeyFields[placeholder[1:len(placeholder)-1]](e))
+	})
+}
+
+func routingKeyWord(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return unknownKeyWord
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '*', '#':
+			return '_'
+		}
+		return r
+	}, v)
+}
@@ -3,91 +3,371 @@ package event
 import (
 	"context"
 	"cortex-task/internal/article"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Publisher interface {
-	PublishArticleUpdated(ctx context.Context, a *article.Article) error
+	Publish(ctx context.Context, e Event) error
+}
+
+// changeEvent is the part of a change stream event we publish from, see changeStreamPipeline.
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription        *updateDescription `bson:"updateDescription"`
+	FullDocument             *article.Article   `bson:"fullDocument"`
+	FullDocumentBeforeChange *struct {
+		ExternalID int64 `bson:"externalId"`
+	} `bson:"fullDocumentBeforeChange"`
+}
+
+type updateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// toEvent returns the event to publish, false when there's nothing to publish it with.
+func (c changeEvent) toEvent() (Event, bool) {
+	if c.OperationType == "delete" {
+		e := Event{Type: ArticleDeleted, DocumentID: c.DocumentKey.ID}
+		if c.FullDocumentBeforeChange != nil {
+			e.ExternalID = c.FullDocumentBeforeChange.ExternalID
+		}
+		return e, true
+	}
+	if c.FullDocument == nil {
+		return Event{}, false
+	}
+
+	e := Event{
+		DocumentID: c.FullDocument.ID,
+		ExternalID: c.FullDocument.ExternalID,
+		Article:    c.FullDocument,
+	}
+	if c.OperationType != "insert" {
+		e.Changes = c.FullDocument.LastChanges
+	}
+
+	// the paths and new values come straight from updateDescription, so a manual edit is described as well as
+	// an ingest one. replaces and inserts don't have one
+	fields := make([]string, 0)
+	if d := c.UpdateDescription; d != nil {
+		for field, value := range d.UpdatedFields {
+			fields = append(fields, field)
+			if _, ok := bookkeepingFields[field]; ok {
+				continue
+			}
+			if e.Updated == nil {
+				e.Updated = make(map[string]any, len(d.UpdatedFields))
+			}
+			e.Updated[field] = value
+		}
+		fields = append(fields, d.RemovedFields...)
+		e.Removed = d.RemovedFields
+	}
+	e.Type = eventType(c.OperationType, fields)
+	return e, true
 }
 
 type Service struct {
-	col       *mongo.Collection
-	publisher Publisher
-	logger    *log.Logger
+	col          *mongo.Collection
+	checkpoints  CheckpointStore      // optional, the change stream starts from now without one
+	fullDocument options.FullDocument // how the stream fills in fullDocument on updates
+	workers      int                  // change stream events published in parallel, one per article at a time
+	debounce     Debounce             // zero publishes every change on its own
+	feed         article.ChangeFeed   // set instead of col when the storage backend has no change streams
+	publisher    Publisher
+	backoff      func(attempts int) time.Duration // between attempts at publishing an event
+	logger       *log.Logger
+}
+
+// NewService publishes from a change stream on col. fullDocument is options.UpdateLookup (the default when
+// empty), or options.WhenAvailable / options.Required to use the post-image of collections that have
+// changeStreamPreAndPostImages enabled, which is exactly the state written by the change. Events are published
+// by up to workers at a time, changes to the same article one after the other, and coalesced per debounce.
+func NewService(
+	col *mongo.Collection,
+	checkpoints CheckpointStore,
+	fullDocument options.FullDocument,
+	workers int,
+	debounce Debounce,
+	publisher Publisher,
+	logger *log.Logger,
+) *Service {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if fullDocument == "" {
+		fullDocument = options.UpdateLookup
+	}
+
+	return &Service{
+		col:          col,
+		checkpoints:  checkpoints,
+		fullDocument: fullDocument,
+		workers:      max(workers, 1),
+		debounce:     debounce,
+		publisher:    publisher,
+		backoff:      relayBackoff,
+		logger:       logger,
+	}
 }
 
-func NewService(col *mongo.Collection, publisher Publisher, logger *log.Logger) *Service {
+// NewFeedService publishes the changes from a repository's own change feed, used by storage backends that
+// don't have MongoDB change streams.
+func NewFeedService(feed article.ChangeFeed, debounce Debounce, publisher Publisher, logger *log.Logger) *Service {
 	if logger == nil {
 		logger = log.Default()
 	}
 
 	return &Service{
-		col:       col,
+		feed:      feed,
+		workers:   1,
+		debounce:  debounce,
 		publisher: publisher,
+		backoff:   relayBackoff,
 		logger:    logger,
 	}
 }
 
+// Run publishes until ctx is cancelled. A change stream that fails, to open or mid-way, is reopened with backoff
+// from the last checkpoint, so the events after it are published again rather than lost.
 func (s *Service) Run(ctx context.Context) {
-	stream, err := s.col.Watch(ctx, mongo.Pipeline{})
-	if err != nil {
-		s.logger.Printf("events: failed to open change stream: %v", err)
+	if s.feed != nil {
+		s.runFeed(ctx)
 		return
 	}
-	defer stream.Close(ctx)
 
-	s.logger.Println("events: watching MongoDB change stream...")
+	for attempt := 1; ; attempt++ {
+		read, err := s.watch(ctx)
+		if ctx.Err() != nil {
+			s.logger.Println("events: change stream stopped")
+			return
+		}
+		if read {
+			attempt = 1
+		}
+
+		delay := s.backoff(attempt)
+		s.logger.Printf("events: change stream failed, reopening in %v: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watch publishes from one change stream until it fails or ctx is cancelled, read tells whether it got any
+// event at all. The events handed to the workers are published and checkpointed before it returns.
+func (s *Service) watch(ctx context.Context) (read bool, err error) {
+	stream, err := s.openStream(ctx)
+	if err != nil {
+		return false, fmt.Errorf("opening change stream: %w", err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	// checkpoints are saved on shutdown too, for the events that were published before it
+	submit, stop := s.startPublishing(ctx, func(token bson.Raw) {
+		s.saveCheckpoint(context.WithoutCancel(ctx), token)
+	})
+	defer stop()
 
 	for stream.Next(ctx) {
-		var event bson.M
+		var event changeEvent
 		if err := stream.Decode(&event); err != nil {
-			s.logger.Printf("events: failed decoding change event: %v", err)
-			continue
+			// skipping it would checkpoint past it, the stream is reopened from the last checkpoint instead
+			return read, fmt.Errorf("decoding change event: %w", err)
 		}
+		read = true
 
-		docID, ok := extractDocumentID(event)
-		if !ok || docID == primitive.NilObjectID {
-			s.logger.Printf("events: skip event missing _id in documentKey")
+		e, ok := event.toEvent()
+		if !ok {
+			// with updateLookup the document was deleted before the lookup ran, the delete is published on its own
+			s.logger.Printf("events: skip %s of %s without a full document", event.OperationType, event.DocumentKey.ID.Hex())
+			submit(nil, stream.ResumeToken())
 			continue
 		}
 
-		var a article.Article
-		if err := s.col.FindOne(ctx, bson.M{"_id": docID}).Decode(&a); err != nil {
-			s.logger.Printf("events: failed fetching updated article %s: %v", docID.Hex(), err)
-			continue
+		submit(&e, stream.ResumeToken())
+	}
+
+	if err := stream.Err(); err != nil {
+		return read, err
+	}
+	return read, errors.New("change stream closed")
+}
+
+// startPublishing starts the workers, and the debouncer in front of them when there's a window. submit hands
+// them the events in stream order, stop waits for the ones already handed over.
+func (s *Service) startPublishing(ctx context.Context, checkpoint func(bson.Raw)) (submit func(*Event, bson.Raw), stop func()) {
+	pool := newPublishPool(s.workers, s.publish, checkpoint)
+	pool.start(ctx)
+	if !s.debounce.enabled() {
+		return pool.submit, pool.stop
+	}
+
+	d := newDebouncer(s.debounce, pool)
+	d.start()
+	submit = func(e *Event, token bson.Raw) {
+		if e == nil {
+			pool.submit(nil, token)
+			return
 		}
+		d.add(*e, token)
+	}
+	stop = func() {
+		d.stop()
+		pool.stop()
+	}
+	return submit, stop
+}
 
-		if err := s.publisher.PublishArticleUpdated(ctx, &a); err != nil {
-			s.logger.Printf("events: failed publishing article %d: %v", a.ExternalID, err)
-			continue
+// openStream resumes after the last published event when there's a stored resume token. a token that has
+// aged out of the oplog can't be resumed from, the stream then starts from now and whatever changed in
+// between is not published.
+func (s *Service) openStream(ctx context.Context) (*mongo.ChangeStream, error) {
+	var token bson.Raw
+	if s.checkpoints != nil {
+		var err error
+		if token, err = s.checkpoints.Load(ctx); err != nil {
+			return nil, fmt.Errorf("loading resume token: %w", err)
 		}
+	}
 
-		s.logger.Printf("events: published article %d to message bus", a.ExternalID)
+	if token == nil {
+		s.logger.Println("events: watching MongoDB change stream...")
+		return s.col.Watch(ctx, changeStreamPipeline(), s.streamOptions())
 	}
 
-	if err := stream.Err(); err != nil {
-		s.logger.Printf("events: change stream closed with error: %v", err)
+	stream, err := s.col.Watch(ctx, changeStreamPipeline(), s.streamOptions().SetStartAfter(token))
+	if isResumeTokenLost(err) {
+		s.logger.Printf("events: WARNING resume token is no longer in the oplog, changes made since the last published event are skipped: %v", err)
+		return s.col.Watch(ctx, changeStreamPipeline(), s.streamOptions())
+	}
+	if err == nil {
+		s.logger.Println("events: resuming MongoDB change stream after the last published event...")
+	}
+	return stream, err
+}
+
+// streamOptions asks for pre-images too when post-images are in use, so deletes carry the externalId.
+func (s *Service) streamOptions() *options.ChangeStreamOptions {
+	opts := options.ChangeStream().SetFullDocument(s.fullDocument)
+	if s.fullDocument != options.UpdateLookup {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	return opts
+}
+
+// saveCheckpoint stores token once the events up to it are published so a restart resumes right after it. a
+// failed save is only logged, the worst case is the events since the previous save are published again.
+func (s *Service) saveCheckpoint(ctx context.Context, token bson.Raw) {
+	if s.checkpoints == nil || token == nil {
+		return
+	}
+	if err := s.checkpoints.Save(ctx, token); err != nil {
+		s.logger.Printf("events: failed saving resume token: %v", err)
+	}
+}
+
+// runFeed publishes the changes after the last published one, or every change committed after startup the
+// first time. the feed already carries the article state so there is no lookup per change.
+func (s *Service) runFeed(ctx context.Context) {
+	after, ok, err := s.feed.Position()
+	if err == nil && !ok {
+		after, err = s.feed.LastSeq()
+	}
+	if err != nil {
+		s.logger.Printf("events: failed reading change feed position: %v", err)
+		return
+	}
+
+	if ok {
+		s.logger.Printf("events: resuming local change feed after %d...", after)
 	} else {
-		s.logger.Println("events: change stream stopped")
+		s.logger.Printf("events: watching local change feed after %d...", after)
 	}
+
+	// the seq of each change goes through the workers like a resume token, see feedToken
+	submit, stop := s.startPublishing(ctx, func(token bson.Raw) {
+		s.saveFeedPosition(token)
+	})
+	defer stop()
+
+	for change := range s.feed.Subscribe(ctx, after) {
+		a := change.Article
+		e := articleEvent(string(change.Op), &a, change.Changes)
+		submit(&e, feedToken(change.Seq))
+	}
+
+	s.logger.Println("events: change feed stopped")
+}
+
+// feedToken is the change feed's counterpart of a change stream resume token.
+func feedToken(seq uint64) bson.Raw {
+	token, _ := bson.Marshal(bson.M{"seq": int64(seq)})
+	return token
 }
 
-// extractDocumentID extracts the MongoDB _id from the change stream event's documentKey.
-// Change streams always include _id in documentKey, not arbitrary fields like externalId.
-func extractDocumentID(event bson.M) (primitive.ObjectID, bool) {
-	docKey, ok := event["documentKey"].(bson.M)
+// saveFeedPosition stores the seq in token once the changes up to it are published. like saveCheckpoint a
+// failed save is only logged.
+func (s *Service) saveFeedPosition(token bson.Raw) {
+	seq, ok := token.Lookup("seq").Int64OK()
 	if !ok {
-		return primitive.NilObjectID, false
+		return
+	}
+	if err := s.feed.SavePosition(uint64(seq)); err != nil {
+		s.logger.Printf("events: failed saving change feed position: %v", err)
 	}
+}
 
-	id, ok := docKey["_id"].(primitive.ObjectID)
-	if !ok {
-		return primitive.NilObjectID, false
+// publish retries e with backoff until it's published, an event is never skipped: its worker and the
+// checkpoint wait for it. It only gives up, returning false, when ctx is cancelled.
+func (s *Service) publish(ctx context.Context, e Event) bool {
+	for attempt := 1; ; attempt++ {
+		err := s.publisher.Publish(ctx, e)
+		if err == nil {
+			s.logger.Printf("events: published %s for article %d to message bus", e.Type, e.ExternalID)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		delay := s.backoff(attempt)
+		s.logger.Printf("events: failed publishing %s for article %d (attempt %d), retrying in %v: %v",
+			e.Type, e.ExternalID, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
 	}
+}
 
-	return id, true
+// changeStreamPipeline only passes the writes that produce an event and drops the parts of the change event we
+// don't read (ns, truncatedArrays, the rest of the pre-image, ...) on the server.
+func changeStreamPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}}},
+		{{Key: "$project", Value: bson.M{
+			"operationType":                       1,
+			"documentKey":                         1,
+			"fullDocument":                        1,
+			"updateDescription.updatedFields":     1,
+			"updateDescription.removedFields":     1,
+			"fullDocumentBeforeChange.externalId": 1,
+		}}},
+	}
 }
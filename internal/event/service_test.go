@@ -3,15 +3,32 @@ package event
 import (
 	"context"
 	"cortex-task/internal/article"
+	"cortex-task/internal/db"
+	"cortex-task/internal/spool"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // -------------------------
@@ -43,7 +60,10 @@ func newTestPublisher(mockCh *MockAMQPChannel) *RabbitPublisher {
 		conn:       nil,
 		ch:         mockCh,
 		exchange:   "cms.sync",
+		state:      StateConnected,
+		done:       make(chan struct{}),
 		routingKey: "article.updated",
+		retryDelay: time.Millisecond,
 		logger:     log.New(io.Discard, "", 0),
 	}
 }
@@ -167,3 +187,1158 @@ func TestPublishArticleUpdatedContextCancel(t *testing.T) {
 
 	mockCh.AssertExpectations(t)
 }
+
+func TestPublishArticleUpdatedIncludesChanges(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+
+	art := &article.Article{
+		ExternalID: 55,
+		LastChanges: []article.FieldChange{
+			{Field: "leadMedia.imageUrl", Old: "a.jpg", New: "b.jpg"},
+		},
+	}
+
+	var capturedMsg amqp.Publishing
+	mockCh.
+		On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			capturedMsg = args.Get(5).(amqp.Publishing)
+		}).
+		Once()
+
+	require.NoError(t, pub.PublishArticleUpdated(context.Background(), art))
+
+	assert.Contains(t, string(capturedMsg.Body), `"changes":[{"field":"leadMedia.imageUrl","old":"a.jpg","new":"b.jpg"}]`)
+}
+
+// -------------------------
+// Change feed
+// -------------------------
+
+type mockPublisher struct {
+	mock.Mock
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, e Event) error {
+	args := m.Called(ctx, e)
+	return args.Error(0)
+}
+
+type fakeFeed struct {
+	last     uint64
+	position *uint64 // saved position, nil before the first save
+	changes  []article.Change
+	after    uint64
+
+	mu    sync.Mutex
+	saved []uint64
+}
+
+func (f *fakeFeed) LastSeq() (uint64, error) { return f.last, nil }
+
+func (f *fakeFeed) Position() (uint64, bool, error) {
+	if f.position == nil {
+		return 0, false, nil
+	}
+	return *f.position, true, nil
+}
+
+func (f *fakeFeed) SavePosition(seq uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved = append(f.saved, seq)
+	return nil
+}
+
+func (f *fakeFeed) Subscribe(ctx context.Context, after uint64) <-chan article.Change {
+	f.after = after
+	ch := make(chan article.Change)
+	go func() {
+		defer close(ch)
+		for _, c := range f.changes {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func TestFeedServicePublishesFromLastSeq(t *testing.T) {
+	media := []article.FieldChange{{Field: "leadMedia.imageUrl", Old: "a.jpg", New: "b.jpg"}}
+	feed := &fakeFeed{
+		last: 41,
+		changes: []article.Change{
+			{Seq: 42, Op: article.ChangeInsert, ExternalID: 1, Article: article.Article{ExternalID: 1}},
+			{Seq: 43, Op: article.ChangeUpdate, ExternalID: 2, Changes: media, Article: article.Article{ExternalID: 2}},
+		},
+	}
+	pub := &mockPublisher{}
+	pub.On("Publish", mock.Anything, Event{
+		Type:       ArticleCreated,
+		ExternalID: 1,
+		Article:    &article.Article{ExternalID: 1},
+	}).Return(nil).Once()
+	pub.On("Publish", mock.Anything, Event{
+		Type:       ArticleMediaUpdated,
+		ExternalID: 2,
+		Changes:    media,
+		Article:    &article.Article{ExternalID: 2},
+		Updated:    map[string]any{"leadMedia.imageUrl": "b.jpg"},
+	}).Return(errors.New("boom")).Once()
+	pub.On("Publish", mock.Anything, mock.MatchedBy(func(e Event) bool { return e.ExternalID == 2 })).Return(nil).Once()
+
+	svc := NewFeedService(feed, Debounce{}, pub, log.New(io.Discard, "", 0))
+	svc.backoff = func(int) time.Duration { return time.Millisecond }
+	svc.Run(context.Background())
+
+	assert.Equal(t, uint64(41), feed.after)
+	assert.Equal(t, uint64(43), feed.saved[len(feed.saved)-1], "the failed publish is retried, not skipped")
+	pub.AssertExpectations(t)
+}
+
+func TestFeedServiceResumesFromSavedPosition(t *testing.T) {
+	position := uint64(5)
+	feed := &fakeFeed{
+		last:     9,
+		position: &position,
+		changes: []article.Change{
+			{Seq: 6, Op: article.ChangeInsert, ExternalID: 1, Article: article.Article{ExternalID: 1}},
+			{Seq: 7, Op: article.ChangeInsert, ExternalID: 2, Article: article.Article{ExternalID: 2}},
+		},
+	}
+	pub := &mockPublisher{}
+	pub.On("Publish", mock.Anything, mock.Anything).Return(nil).Twice()
+
+	NewFeedService(feed, Debounce{}, pub, log.New(io.Discard, "", 0)).Run(context.Background())
+
+	assert.Equal(t, uint64(5), feed.after, "changes committed while stopped are published")
+	require.NotEmpty(t, feed.saved)
+	assert.Equal(t, uint64(7), feed.saved[len(feed.saved)-1])
+	pub.AssertExpectations(t)
+}
+
+func TestRelayBackoff(t *testing.T) {
+	assert.Equal(t, relayBaseBackoff, relayBackoff(1))
+	assert.Equal(t, 4*relayBaseBackoff, relayBackoff(3))
+	assert.Equal(t, relayMaxBackoff, relayBackoff(50))
+}
+
+// newOutboxTestDB is an empty database for relay tests, they're skipped without MongoDB.
+func newOutboxTestDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	ctx := context.Background()
+
+	client, err := db.ConnectMongo(ctx, "mongodb://localhost:27017")
+	if err != nil {
+		t.Skipf("outbox relay tests need MongoDB at localhost:27017: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	database := client.Database("test_newsdb_outbox")
+	require.NoError(t, database.Drop(ctx))
+	t.Cleanup(func() { _ = database.Drop(ctx) })
+	return database
+}
+
+func outboxTestRecord(id int64, status, owner string, leaseUntil time.Time) article.OutboxRecord {
+	return article.OutboxRecord{
+		ID:         primitive.NewObjectIDFromTimestamp(time.Unix(1700000000+id, 0)),
+		ExternalID: id,
+		Op:         article.ChangeInsert,
+		Article:    article.Article{ExternalID: id},
+		Status:     status,
+		Owner:      owner,
+		LeaseUntil: leaseUntil,
+	}
+}
+
+func TestOutboxRelayClaimsTheHeadAndTakesOverExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	database := newOutboxTestDB(t)
+	col := database.Collection(article.OutboxCollection)
+
+	now := time.Now()
+	record := outboxTestRecord
+	_, err := col.InsertMany(ctx, []any{
+		record(1, article.OutboxPublishing, "other", now.Add(time.Minute)),
+		record(2, article.OutboxPending, "", time.Time{}),
+	})
+	require.NoError(t, err)
+
+	pub := &mockPublisher{}
+	relay := NewOutboxRelay(database, pub, time.Second, log.New(io.Discard, "", 0))
+
+	// another relay holds the head, nothing after it is published either
+	n, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	pub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+	// once its lease runs out the head is taken over
+	_, err = col.UpdateOne(ctx, bson.M{"externalId": 1}, bson.M{"$set": bson.M{"leaseUntil": now.Add(-time.Second)}})
+	require.NoError(t, err)
+
+	var order []int64
+	pub.On("Publish", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { order = append(order, args.Get(1).(Event).ExternalID) }).
+		Return(nil)
+
+	n, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1, 2}, order)
+
+	var done []article.OutboxRecord
+	cur, err := col.Find(ctx, bson.M{"status": article.OutboxDone})
+	require.NoError(t, err)
+	require.NoError(t, cur.All(ctx, &done))
+	require.Len(t, done, 2)
+	assert.Empty(t, done[0].Owner)
+}
+
+func TestOutboxRelayRenewsItsClaimWhilePublishing(t *testing.T) {
+	ctx := context.Background()
+	database := newOutboxTestDB(t)
+	_, err := database.Collection(article.OutboxCollection).InsertOne(ctx, outboxTestRecord(1, article.OutboxPending, "", time.Time{}))
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	slow := NewOutboxRelay(database, publisherFunc(func(context.Context, Event) error {
+		<-release
+		return nil
+	}), time.Second, log.New(io.Discard, "", 0))
+	slow.lease = 90 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := slow.RunOnce(ctx)
+		done <- err
+	}()
+
+	// well past the lease the claim is still live, another relay doesn't take the record over
+	time.Sleep(4 * slow.lease)
+	other := &mockPublisher{}
+	n, err := NewOutboxRelay(database, other, time.Second, log.New(io.Discard, "", 0)).RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	other.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestOutboxRelayOnlyGivesUpOnUnencodableRecords(t *testing.T) {
+	ctx := context.Background()
+	database := newOutboxTestDB(t)
+	col := database.Collection(article.OutboxCollection)
+
+	// a record that has failed many times already, the broker is still down
+	rec := outboxTestRecord(1, article.OutboxPending, "", time.Time{})
+	rec.Attempts = 50
+	_, err := col.InsertOne(ctx, rec)
+	require.NoError(t, err)
+
+	pub := &mockPublisher{}
+	pub.On("Publish", mock.Anything, mock.Anything).Return(ErrUnconfirmed).Once()
+	relay := NewOutboxRelay(database, pub, time.Second, log.New(io.Discard, "", 0))
+
+	_, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	var got article.OutboxRecord
+	require.NoError(t, col.FindOne(ctx, bson.M{"_id": rec.ID}).Decode(&got))
+	assert.Equal(t, article.OutboxPending, got.Status)
+	assert.Equal(t, 51, got.Attempts)
+
+	// one that can't be encoded is given up on
+	_, err = col.UpdateByID(ctx, rec.ID, bson.M{"$set": bson.M{"nextAttemptAt": time.Now().Add(-time.Second)}})
+	require.NoError(t, err)
+	pub.On("Publish", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: no article", ErrUnencodable)).Once()
+
+	_, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.NoError(t, col.FindOne(ctx, bson.M{"_id": rec.ID}).Decode(&got))
+	assert.Equal(t, article.OutboxFailed, got.Status)
+}
+
+func TestIsResumeTokenLost(t *testing.T) {
+	assert.True(t, isResumeTokenLost(mongo.CommandError{Code: codeChangeStreamHistory, Message: "history lost"}))
+	assert.True(t, isResumeTokenLost(mongo.CommandError{Code: codeInvalidResumeToken}))
+	assert.False(t, isResumeTokenLost(mongo.CommandError{Code: 11000}))
+	assert.False(t, isResumeTokenLost(errors.New("boom")))
+	assert.False(t, isResumeTokenLost(nil))
+}
+
+func TestChangeStreamPipelineFiltersOperations(t *testing.T) {
+	pipeline := changeStreamPipeline()
+
+	require.Len(t, pipeline, 2)
+	assert.Equal(t, "$match", pipeline[0][0].Key)
+	assert.Equal(t, bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}, pipeline[0][0].Value)
+	assert.Equal(t, "$project", pipeline[1][0].Key)
+	assert.NotContains(t, pipeline[1][0].Value, "updateDescription")
+}
+
+func TestEventType(t *testing.T) {
+	assert.Equal(t, ArticleCreated, eventType("insert", nil))
+	assert.Equal(t, ArticleDeleted, eventType("delete", nil))
+	assert.Equal(t, ArticleUpdated, eventType("update", []string{"title", "leadMedia.imageUrl"}))
+	assert.Equal(t, ArticleUpdated, eventType("replace", nil))
+	assert.Equal(t, ArticleMediaUpdated, eventType("update", []string{"leadMedia", "lastChanges", "modifiedAt", "revision"}))
+	assert.Equal(t, ArticleMediaUpdated, eventType("update", []string{"leadMedia.imageUrl"}))
+	assert.Equal(t, ArticleUpdated, eventType("update", []string{"modifiedAt"}))
+}
+
+func TestChangeEventToEvent(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	var deleted changeEvent
+	deleted.OperationType = "delete"
+	deleted.DocumentKey.ID = id
+	e, ok := deleted.toEvent()
+	require.True(t, ok)
+	assert.Equal(t, Event{Type: ArticleDeleted, DocumentID: id}, e)
+
+	lookupMissed := changeEvent{OperationType: "update"}
+	_, ok = lookupMissed.toEvent()
+	assert.False(t, ok)
+
+	changes := []article.FieldChange{{Field: "title", Old: "a", New: "b"}}
+	updated := changeEvent{
+		OperationType: "update",
+		FullDocument:  &article.Article{ID: id, ExternalID: 9, LastChanges: changes},
+	}
+	updated.UpdateDescription = &updateDescription{
+		UpdatedFields: bson.M{"title": "b", "lastChanges": bson.A{}, "modifiedAt": "now", "revision": 2},
+		RemovedFields: []string{"tags"},
+	}
+	e, ok = updated.toEvent()
+	require.True(t, ok)
+	assert.Equal(t, ArticleUpdated, e.Type)
+	assert.Equal(t, int64(9), e.ExternalID)
+	assert.Equal(t, changes, e.Changes)
+	assert.Equal(t, map[string]any{"title": "b"}, e.Updated)
+	assert.Equal(t, []string{"tags"}, e.Removed)
+}
+
+func TestPublishRoutesByEventType(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+	id := primitive.NewObjectID()
+
+	var deletedMsg amqp.Publishing
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.created", false, false, mock.Anything).Return(nil).Once()
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.media.updated", false, false, mock.Anything).Return(nil).Once()
+	mockCh.
+		On("PublishWithContext", mock.Anything, "cms.sync", "article.deleted", false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			deletedMsg = args.Get(5).(amqp.Publishing)
+		}).
+		Once()
+
+	ctx := context.Background()
+	require.NoError(t, pub.Publish(ctx, Event{Type: ArticleCreated, Article: &article.Article{ExternalID: 1}}))
+	require.NoError(t, pub.Publish(ctx, Event{Type: ArticleMediaUpdated, Article: &article.Article{ExternalID: 1}}))
+	require.NoError(t, pub.Publish(ctx, Event{Type: ArticleDeleted, DocumentID: id, ExternalID: 1}))
+
+	assert.Contains(t, string(deletedMsg.Body), `"event":"article.deleted"`)
+	assert.Contains(t, string(deletedMsg.Body), `"documentId":"`+id.Hex()+`"`)
+	mockCh.AssertExpectations(t)
+}
+
+func TestRoutingKeyTemplate(t *testing.T) {
+	keys, err := ParseRoutingKeyTemplate("article.{event}.{language}.{type}")
+	require.NoError(t, err)
+
+	report := &article.Article{Language: "EN", Type: "match report"}
+	assert.Equal(t, "article.updated.en.match_report", keys.Key(Event{Type: ArticleUpdated, Article: report}))
+	assert.Equal(t, "article.media_updated.en.match_report", keys.Key(Event{Type: ArticleMediaUpdated, Article: report}))
+	assert.Equal(t, "article.deleted.unknown.unknown", keys.Key(Event{Type: ArticleDeleted}))
+
+	_, err = ParseRoutingKeyTemplate("article.{event}.{country}")
+	assert.ErrorContains(t, err, "{country}")
+	_, err = ParseRoutingKeyTemplate("article.{event")
+	assert.ErrorContains(t, err, "unbalanced")
+}
+
+func TestPublishRoutesByTemplate(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+	pub.format = MessageFormat{Versions: []int{SchemaV1, SchemaV2}}
+	keys, err := ParseRoutingKeyTemplate("article.{event}.{language}.{type}")
+	require.NoError(t, err)
+	pub.keys = keys
+
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.created.en.text", false, false, mock.Anything).Return(nil).Once()
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "v2.article.created.en.text", false, false, mock.Anything).Return(nil).Once()
+
+	a := &article.Article{ExternalID: 1, Language: "en", Type: "text"}
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleCreated, ExternalID: 1, Article: a}))
+	mockCh.AssertExpectations(t)
+}
+
+func TestMessageBodyPayloadModes(t *testing.T) {
+	now := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	modified := time.Date(2025, 11, 30, 9, 0, 0, 0, time.UTC)
+	id := primitive.NewObjectID()
+	e := Event{
+		Type:       ArticleUpdated,
+		DocumentID: id,
+		ExternalID: 7,
+		Changes:    []article.FieldChange{{Field: "title", Old: "a", New: "b"}},
+		Article:    &article.Article{ID: id, ExternalID: 7, Title: "b", Body: "<p>long</p>", LastModified: modified, Revision: 4},
+		Updated:    map[string]any{"title": "b"},
+	}
+
+	full, err := messageBody(e, PayloadFull, now)
+	require.NoError(t, err)
+	assert.Contains(t, string(full), `"Body":"\u003cp\u003elong\u003c/p\u003e"`)
+
+	delta, err := messageBody(e, PayloadDelta, now)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"event": "article.updated",
+		"timestamp": "2025-12-01T10:00:00Z",
+		"documentId": "`+id.Hex()+`",
+		"externalId": 7,
+		"lastModified": "2025-11-30T09:00:00Z",
+		"revision": 4,
+		"updated": {"title": "b"}
+	}`, string(delta))
+
+	ref, err := messageBody(e, PayloadReference, now)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ref), `"updated":`)
+	assert.NotContains(t, string(ref), "long")
+	assert.Contains(t, string(ref), `"revision":4`)
+}
+
+func TestPublishSideBySideVersions(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+	pub.format = MessageFormat{Versions: []int{SchemaV1, SchemaV2}, Source: "/news-sync"}
+
+	var v1, v2 amqp.Publishing
+	mockCh.
+		On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { v1 = args.Get(5).(amqp.Publishing) }).
+		Once()
+	mockCh.
+		On("PublishWithContext", mock.Anything, "cms.sync", "v2.article.updated", false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { v2 = args.Get(5).(amqp.Publishing) }).
+		Once()
+
+	require.NoError(t, pub.PublishArticleUpdated(context.Background(), &article.Article{ExternalID: 1234, Title: "Test Title", Revision: 2}))
+
+	assert.Equal(t, "application/json", v1.ContentType)
+	assert.Contains(t, string(v1.Body), `"ExternalID":1234`)
+
+	assert.Equal(t, cloudEventsContentType, v2.ContentType)
+	var ce map[string]any
+	require.NoError(t, json.Unmarshal(v2.Body, &ce))
+	assert.Equal(t, "1.0", ce["specversion"])
+	assert.Equal(t, "article.updated:1234:2", ce["id"])
+	assert.Equal(t, "/news-sync", ce["source"])
+	assert.Equal(t, "article.updated", ce["type"])
+	assert.Equal(t, "1234", ce["subject"])
+	assert.Equal(t, "urn:news-sync:schema:article:2", ce["dataschema"])
+	data := ce["data"].(map[string]any)["article"].(map[string]any)
+	assert.Equal(t, float64(1234), data["externalId"])
+	assert.Equal(t, "Test Title", data["title"])
+	mockCh.AssertExpectations(t)
+}
+
+func TestPublishSetsMessageIDAndHeaders(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+	pub.format = MessageFormat{Versions: []int{SchemaV1, SchemaV2}}
+
+	var msgs []amqp.Publishing
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", mock.Anything, false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { msgs = append(msgs, args.Get(5).(amqp.Publishing)) })
+
+	a := &article.Article{ExternalID: 1234, Type: "text", Language: "en", Revision: 3}
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleMediaUpdated, ExternalID: 1234, Article: a}))
+	require.Len(t, msgs, 2)
+
+	for i, msg := range msgs {
+		assert.Equal(t, "article.media.updated:1234:3", msg.MessageId, "every version has the same id")
+		assert.Equal(t, "article.media.updated", msg.Type)
+		assert.Equal(t, amqp.Table{
+			HeaderEventType:     "article.media.updated",
+			HeaderSchemaVersion: int32(i + 1),
+			HeaderArticleType:   "text",
+			HeaderLanguage:      "en",
+		}, msg.Headers)
+	}
+
+	id := primitive.NewObjectID()
+	assert.Equal(t, amqp.Table{HeaderEventType: "article.deleted", HeaderSchemaVersion: int32(SchemaV1)},
+		messageHeaders(Event{Type: ArticleDeleted, DocumentID: id}, SchemaV1))
+}
+
+func TestEventIDWithoutRevisionHashesTheArticle(t *testing.T) {
+	e := Event{Type: ArticleUpdated, ExternalID: 1, Article: &article.Article{ExternalID: 1, Title: "a"}}
+	same := Event{Type: ArticleUpdated, ExternalID: 1, Article: &article.Article{ExternalID: 1, Title: "a"}}
+	edited := Event{Type: ArticleUpdated, ExternalID: 1, Article: &article.Article{ExternalID: 1, Title: "b"}}
+
+	assert.Regexp(t, `^article\.updated:1:h[0-9a-f]{16}$`, eventID(e))
+	assert.Equal(t, eventID(e), eventID(same))
+	assert.NotEqual(t, eventID(e), eventID(edited))
+}
+
+func TestCloudEventBodyDeleted(t *testing.T) {
+	id := primitive.NewObjectID()
+	now := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	body, err := cloudEventBody(Event{Type: ArticleDeleted, DocumentID: id}, MessageFormat{Payload: PayloadDelta, Source: "/news-sync"}, now)
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "article.deleted:`+id.Hex()+`",
+		"source": "/news-sync",
+		"type": "article.deleted",
+		"time": "2025-12-01T10:00:00Z",
+		"datacontenttype": "application/json",
+		"dataschema": "urn:news-sync:schema:article.deleted:2",
+		"data": {"documentId": "`+id.Hex()+`"}
+	}`, string(body))
+}
+
+func TestPublishRetriesNackedMessages(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).Return(ErrNacked).Once()
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).Return(ErrUnconfirmed).Once()
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).Return(nil).Once()
+
+	require.NoError(t, pub.PublishArticleUpdated(context.Background(), &article.Article{ExternalID: 1}))
+	mockCh.AssertExpectations(t)
+}
+
+func TestPublishGivesUpAfterMaxAttempts(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+
+	mockCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).Return(ErrNacked).Times(maxPublishAttempts)
+
+	err := pub.PublishArticleUpdated(context.Background(), &article.Article{ExternalID: 1})
+	require.ErrorIs(t, err, ErrNacked)
+	mockCh.AssertExpectations(t)
+}
+
+func TestPublishWaitsForReconnect(t *testing.T) {
+	oldCh := &MockAMQPChannel{}
+	newCh := &MockAMQPChannel{}
+	pub := newTestPublisher(oldCh)
+
+	oldCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).
+		Return(amqp.ErrClosed).
+		Run(func(mock.Arguments) {
+			// the watcher notices the closed channel and brings up a new one a little later
+			pub.setReconnecting()
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				pub.setConnected(nil, newCh)
+			}()
+		}).
+		Once()
+	newCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).Return(nil).Once()
+
+	require.NoError(t, pub.PublishArticleUpdated(context.Background(), &article.Article{ExternalID: 1}))
+	assert.Equal(t, StateConnected, pub.State())
+	oldCh.AssertExpectations(t)
+	newCh.AssertExpectations(t)
+}
+
+func TestPublishWhileReconnectingHonoursContext(t *testing.T) {
+	pub := newTestPublisher(&MockAMQPChannel{})
+	pub.setReconnecting()
+	assert.Equal(t, StateReconnecting, pub.State())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := pub.PublishArticleUpdated(ctx, &article.Article{ExternalID: 1})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPublishAfterClose(t *testing.T) {
+	mockCh := &MockAMQPChannel{}
+	pub := newTestPublisher(mockCh)
+	pub.Close()
+
+	require.ErrorIs(t, pub.PublishArticleUpdated(context.Background(), &article.Article{}), ErrPublisherClosed)
+	assert.Equal(t, StateClosed, pub.State())
+}
+
+type closeRecordingChannel struct {
+	MockAMQPChannel
+	closed bool
+}
+
+func (c *closeRecordingChannel) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReconnectAfterCloseIsClosedAgain(t *testing.T) {
+	pub := newTestPublisher(&MockAMQPChannel{})
+	pub.Close()
+
+	fresh := &closeRecordingChannel{}
+	assert.False(t, pub.setConnected(nil, fresh))
+	assert.True(t, fresh.closed, "the channel opened while closing is closed too")
+	assert.Equal(t, StateClosed, pub.State())
+}
+
+// -------------------------
+// Spool
+// -------------------------
+
+func newTestSpoolingPublisher(t *testing.T, publisher Publisher) (*SpoolingPublisher, *spool.Spool) {
+	t.Helper()
+	sp, err := spool.Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sp.Close() })
+	return NewSpoolingPublisher(publisher, sp, log.New(io.Discard, "", 0)), sp
+}
+
+func TestSpoolingPublisherSpoolsWhileReconnectingAndDrainsInOrder(t *testing.T) {
+	pub := newTestPublisher(&MockAMQPChannel{})
+	pub.setReconnecting()
+	spooling, _ := newTestSpoolingPublisher(t, pub)
+
+	for id := int64(1); id <= 3; id++ {
+		require.NoError(t, spooling.Publish(context.Background(), Event{
+			Type:       ArticleUpdated,
+			ExternalID: id,
+			Updated:    map[string]any{"title": "t"},
+			Article:    &article.Article{ExternalID: id, Revision: 2},
+		}))
+	}
+	assert.Equal(t, 3, spooling.Depth())
+
+	var published []int64
+	newCh := &MockAMQPChannel{}
+	newCh.On("PublishWithContext", mock.Anything, "cms.sync", "article.updated", false, false, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			var msg ArticleUpdatedMessage
+			require.NoError(t, json.Unmarshal(args.Get(5).(amqp.Publishing).Body, &msg))
+			published = append(published, msg.Article.ExternalID)
+		})
+	pub.setConnected(nil, newCh)
+
+	spooling.drain(context.Background())
+	assert.Equal(t, []int64{1, 2, 3}, published)
+	assert.Equal(t, 0, spooling.Depth())
+}
+
+func TestSpoolingPublisherSpoolsFailedPublish(t *testing.T) {
+	inner := &mockPublisher{}
+	spooling, sp := newTestSpoolingPublisher(t, inner)
+
+	first := Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}
+	second := Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}
+	inner.On("Publish", mock.Anything, first).Return(ErrNacked).Once()
+
+	require.NoError(t, spooling.Publish(context.Background(), first))
+	// the spool isn't empty, the next event queues up behind it without trying the publisher
+	require.NoError(t, spooling.Publish(context.Background(), second))
+	assert.Equal(t, 2, sp.Len())
+	inner.AssertNumberOfCalls(t, "Publish", 1)
+
+	inner.On("Publish", mock.Anything, first).Return(nil).Once()
+	inner.On("Publish", mock.Anything, second).Return(nil).Once()
+	spooling.drain(context.Background())
+
+	assert.Equal(t, 0, sp.Len())
+	inner.AssertExpectations(t)
+}
+
+func TestSpoolingPublisherPublishesInParallel(t *testing.T) {
+	slowID := primitive.NewObjectID()
+	release := make(chan struct{})
+	inner := publisherFunc(func(ctx context.Context, e Event) error {
+		if e.DocumentID == slowID {
+			<-release
+		}
+		return nil
+	})
+	spooling, _ := newTestSpoolingPublisher(t, inner)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- spooling.Publish(context.Background(), Event{Type: ArticleDeleted, DocumentID: slowID})
+	}()
+
+	fastDone := make(chan error, 1)
+	go func() {
+		fastDone <- spooling.Publish(context.Background(), Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()})
+	}()
+	select {
+	case err := <-fastDone:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("publish waited for another article's publish")
+	}
+
+	close(release)
+	require.NoError(t, <-slowDone)
+}
+
+// -------------------------
+// Webhooks
+// -------------------------
+
+func newTestWebhookPublisher(url string, deadLetter Publisher) *WebhookPublisher {
+	p := NewWebhookPublisher(
+		WebhookEndpoint{URL: url, Secret: "s3cret", Timeout: time.Second},
+		MessageFormat{Versions: []int{SchemaV1, SchemaV2}, Source: "/news-sync"},
+		deadLetter,
+		log.New(io.Discard, "", 0),
+	)
+	p.retryDelay = time.Millisecond
+	return p
+}
+
+func TestWebhookPublisherSignsRequests(t *testing.T) {
+	var (
+		req  *http.Request
+		body []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	pub := newTestWebhookPublisher(srv.URL, nil)
+	require.NoError(t, pub.Publish(context.Background(), Event{
+		Type:       ArticleCreated,
+		ExternalID: 1234,
+		Article:    &article.Article{ExternalID: 1234, Revision: 1},
+	}))
+
+	require.NotNil(t, req)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, cloudEventsContentType, req.Header.Get("Content-Type"), "the newest schema version is sent")
+	assert.Equal(t, "article.created:1234:1", req.Header.Get(WebhookEventIDHeader))
+	assert.Equal(t, "article.created", req.Header.Get(WebhookEventTypeHeader))
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(req.Header.Get(WebhookTimestampHeader) + "." + string(body)))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookPublisherRetriesServerErrors(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls++; calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pub := newTestWebhookPublisher(srv.URL, nil)
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}))
+	assert.Equal(t, 3, calls)
+}
+
+func TestWebhookPublisherDeadLettersRejectedEvents(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+
+	e := Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}
+	deadLetter := &mockPublisher{}
+	deadLetter.On("Publish", mock.Anything, e).Return(nil).Once()
+
+	// a rejected event is final, not a failed publish that would be retried forever
+	pub := newTestWebhookPublisher(srv.URL, deadLetter)
+	require.NoError(t, pub.Publish(context.Background(), e))
+	assert.Equal(t, 1, calls)
+	deadLetter.AssertExpectations(t)
+
+	// it's retried when it can't be dead-lettered
+	deadLetter.On("Publish", mock.Anything, e).Return(errors.New("disk full")).Once()
+	require.ErrorContains(t, pub.Publish(context.Background(), e), "disk full")
+}
+
+func TestWebhookPublisherDisablesFailingEndpoint(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	pub := newTestWebhookPublisher(srv.URL, nil)
+	pub.now = func() time.Time { return now }
+
+	e := Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}
+	for range webhookDisableAfter {
+		require.Error(t, pub.Publish(context.Background(), e))
+	}
+	// disabled, the publish fails without a request
+	require.ErrorIs(t, pub.Publish(context.Background(), e), ErrWebhookDisabled)
+	assert.Equal(t, webhookDisableAfter*maxPublishAttempts, calls)
+
+	// after the cool down it gets one more try
+	now = now.Add(webhookDisableFor)
+	err := pub.Publish(context.Background(), e)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrWebhookDisabled)
+	require.ErrorIs(t, pub.Publish(context.Background(), e), ErrWebhookDisabled)
+	assert.Equal(t, (webhookDisableAfter+1)*maxPublishAttempts, calls)
+}
+
+// -------------------------
+// Fan-out
+// -------------------------
+
+type publisherFunc func(ctx context.Context, e Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, e Event) error { return f(ctx, e) }
+
+func newTestSink(t *testing.T, name string, publisher Publisher, maxBytes int64) Sink {
+	t.Helper()
+	sp, err := spool.Open(t.TempDir(), maxBytes, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sp.Close() })
+	return Sink{
+		Name:      name,
+		Publisher: publisher,
+		Spool:     sp,
+		Retry:     RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+}
+
+func TestFanoutPublisherIsolatesSlowSink(t *testing.T) {
+	release := make(chan struct{})
+	slow := publisherFunc(func(ctx context.Context, _ Event) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	got := make(chan int64, 2)
+	fast := publisherFunc(func(_ context.Context, e Event) error {
+		got <- e.ExternalID
+		return nil
+	})
+
+	pub := NewFanoutPublisher([]Sink{newTestSink(t, "slow", slow, 0), newTestSink(t, "fast", fast, 0)}, log.New(io.Discard, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pub.Run(ctx)
+
+	require.NoError(t, pub.Publish(ctx, Event{Type: ArticleUpdated, ExternalID: 1}))
+	require.NoError(t, pub.Publish(ctx, Event{Type: ArticleUpdated, ExternalID: 2}))
+
+	for _, want := range []int64{1, 2} {
+		select {
+		case id := <-got:
+			assert.Equal(t, want, id)
+		case <-time.After(time.Second):
+			t.Fatal("fast sink waited for the slow one")
+		}
+	}
+	// the slow sink is stuck on the first event, both wait in its spool until it's published
+	assert.Equal(t, 2, pub.Health()[0].Queued)
+	close(release)
+	assert.Eventually(t, func() bool { return pub.Health()[0].Queued == 0 }, time.Second, time.Millisecond)
+}
+
+func TestFanoutPublisherRetriesUntilPublished(t *testing.T) {
+	var calls int
+	flaky := publisherFunc(func(context.Context, Event) error {
+		if calls++; calls < 20 {
+			return ErrNacked
+		}
+		return nil
+	})
+	pub := NewFanoutPublisher([]Sink{newTestSink(t, "flaky", flaky, 0)}, log.New(io.Discard, "", 0))
+
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleUpdated, ExternalID: 1}))
+	pub.drainSink(context.Background(), pub.sinks[0])
+
+	assert.Equal(t, 20, calls)
+	health := pub.Health()[0]
+	assert.True(t, health.Healthy)
+	assert.Equal(t, 0, health.Failures)
+	assert.Equal(t, 0, health.Queued)
+}
+
+func TestFanoutPublisherKeepsEventsOfABrokenSinkSpooled(t *testing.T) {
+	broken := publisherFunc(func(context.Context, Event) error { return ErrNacked })
+	sink := newTestSink(t, "broken", broken, 0)
+	pub := NewFanoutPublisher([]Sink{sink}, log.New(io.Discard, "", 0))
+
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleUpdated, ExternalID: 1}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	pub.drainSink(ctx, pub.sinks[0])
+
+	health := pub.Health()[0]
+	assert.False(t, health.Healthy)
+	assert.Greater(t, health.Failures, 1)
+	assert.Equal(t, ErrNacked.Error(), health.LastError)
+	assert.Equal(t, 1, health.Queued, "the event stays spooled for the next attempt or a restart")
+
+	rec, err := sink.Spool.Peek()
+	require.NoError(t, err)
+	e, err := decodeSpooled(rec)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), e.ExternalID)
+}
+
+func TestFanoutPublisherFailsWhenASinkCantSpool(t *testing.T) {
+	pub := NewFanoutPublisher([]Sink{
+		newTestSink(t, "rabbitmq", &mockPublisher{}, 0),
+		newTestSink(t, "webhook", &mockPublisher{}, 1),
+	}, log.New(io.Discard, "", 0))
+
+	err := pub.Publish(context.Background(), Event{Type: ArticleUpdated, ExternalID: 1})
+	require.ErrorIs(t, err, spool.ErrFull)
+	assert.Contains(t, err.Error(), "sink webhook")
+	assert.Equal(t, 1, pub.Health()[0].Queued)
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	r := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, r.delay(1))
+	assert.Equal(t, 4*time.Second, r.delay(3))
+	assert.Equal(t, 5*time.Second, r.delay(10))
+}
+
+func TestFilePublisherAppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	pub, err := NewFilePublisher(path, MessageFormat{})
+	require.NoError(t, err)
+
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}))
+	require.NoError(t, pub.Publish(context.Background(), Event{Type: ArticleDeleted, DocumentID: primitive.NewObjectID()}))
+	require.NoError(t, pub.Close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"event":"article.deleted"`)
+}
+
+// -------------------------
+// Publish pool
+// -------------------------
+
+func TestPublishPoolKeepsArticleOrderAndCheckpointsInOrder(t *testing.T) {
+	slowID, fastID := primitive.NewObjectID(), primitive.NewObjectID()
+	for partition(slowID, 2) == partition(fastID, 2) {
+		fastID = primitive.NewObjectID()
+	}
+
+	release := make(chan struct{})
+	var (
+		mu        sync.Mutex
+		published []int64
+		saved     []string
+	)
+	publish := func(_ context.Context, e Event) bool {
+		if e.DocumentID == slowID && e.ExternalID == 1 {
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, e.ExternalID)
+		return true
+	}
+	checkpoint := func(token bson.Raw) {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = append(saved, token.Lookup("n").StringValue())
+	}
+	token := func(n string) bson.Raw {
+		b, err := bson.Marshal(bson.M{"n": n})
+		require.NoError(t, err)
+		return b
+	}
+
+	pool := newPublishPool(2, publish, checkpoint)
+	pool.start(context.Background())
+
+	pool.submit(&Event{DocumentID: slowID, ExternalID: 1}, token("a"))
+	pool.submit(&Event{DocumentID: fastID, ExternalID: 2}, token("b"))
+	pool.submit(nil, token("c"))
+	pool.submit(&Event{DocumentID: slowID, ExternalID: 3}, token("d"))
+
+	// the other article isn't held up, but nothing is checkpointed past the event still publishing
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 1
+	}, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []int64{2}, published)
+	assert.Empty(t, saved)
+	mu.Unlock()
+
+	close(release)
+	pool.stop()
+
+	assert.Equal(t, []int64{2, 1, 3}, published, "changes to one article keep their order")
+	assert.Equal(t, "d", saved[len(saved)-1])
+	assert.NotContains(t, saved, "b", "b finished first but waited for a")
+}
+
+func TestPublishPoolDoesNotCheckpointEventsCutShortByShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var saved []bson.Raw
+	pool := newPublishPool(1, func(ctx context.Context, _ Event) bool {
+		cancel()
+		return false
+	}, func(token bson.Raw) { saved = append(saved, token) })
+	pool.start(ctx)
+
+	token, err := bson.Marshal(bson.M{"n": "a"})
+	require.NoError(t, err)
+	pool.submit(&Event{DocumentID: primitive.NewObjectID()}, token)
+	pool.stop()
+
+	assert.Empty(t, saved)
+}
+
+func TestPublishPoolNeverCheckpointsPastAFailedPublish(t *testing.T) {
+	var saved []string
+	pool := newPublishPool(1, func(_ context.Context, e Event) bool {
+		return e.ExternalID != 2
+	}, func(token bson.Raw) { saved = append(saved, token.Lookup("n").StringValue()) })
+	pool.start(context.Background())
+
+	id := primitive.NewObjectID()
+	for i, n := range []string{"a", "b", "c"} {
+		token, err := bson.Marshal(bson.M{"n": n})
+		require.NoError(t, err)
+		pool.submit(&Event{DocumentID: id, ExternalID: int64(i + 1)}, token)
+	}
+	pool.stop()
+
+	assert.Equal(t, []string{"a"}, saved, "c was published but b before it wasn't")
+}
+
+// -------------------------
+// Debounce
+// -------------------------
+
+func TestMergeEvents(t *testing.T) {
+	id := primitive.NewObjectID()
+	v1 := &article.Article{ExternalID: 1, Title: "a", Revision: 1}
+	v2 := &article.Article{ExternalID: 1, Title: "b", Revision: 2}
+	v3 := &article.Article{ExternalID: 1, Title: "c", Revision: 3}
+
+	created := Event{Type: ArticleCreated, DocumentID: id, ExternalID: 1, Article: v1}
+	titled := Event{
+		Type:       ArticleUpdated,
+		DocumentID: id,
+		ExternalID: 1,
+		Article:    v2,
+		Changes:    []article.FieldChange{{Field: "title", Old: "a", New: "b"}},
+		Updated:    map[string]any{"title": "b"},
+		Removed:    []string{"summary"},
+	}
+	media := Event{
+		Type:       ArticleMediaUpdated,
+		DocumentID: id,
+		ExternalID: 1,
+		Article:    v3,
+		Changes:    []article.FieldChange{{Field: "title", Old: "b", New: "c"}, {Field: "leadMedia.imageUrl", Old: "x", New: "y"}},
+		Updated:    map[string]any{"title": "c", "leadMedia.imageUrl": "y", "summary": "s"},
+	}
+
+	merged := mergeEvents(titled, media)
+	assert.Equal(t, ArticleUpdated, merged.Type, "an update and a media update are an update")
+	assert.Same(t, v3, merged.Article)
+	assert.Equal(t, []article.FieldChange{
+		{Field: "title", Old: "a", New: "c"},
+		{Field: "leadMedia.imageUrl", Old: "x", New: "y"},
+	}, merged.Changes)
+	assert.Equal(t, map[string]any{"title": "c", "leadMedia.imageUrl": "y", "summary": "s"}, merged.Updated)
+	assert.Nil(t, merged.Removed, "summary was set again")
+
+	assert.Equal(t, ArticleCreated, mergeEvents(created, titled).Type)
+	assert.Equal(t, ArticleMediaUpdated, mergeEvents(media, media).Type)
+
+	deleted := mergeEvents(titled, Event{Type: ArticleDeleted, DocumentID: id})
+	assert.Equal(t, ArticleDeleted, deleted.Type)
+	assert.Equal(t, int64(1), deleted.ExternalID, "known from the earlier change")
+}
+
+func TestDebouncerCoalescesPerArticle(t *testing.T) {
+	now := time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	var (
+		mu        sync.Mutex
+		published []Event
+		saved     []string
+	)
+	pool := newPublishPool(2, func(_ context.Context, e Event) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, e)
+		return true
+	}, func(token bson.Raw) { saved = append(saved, token.Lookup("n").StringValue()) })
+	pool.start(context.Background())
+
+	d := newDebouncer(Debounce{Window: time.Second, MaxDelay: 3 * time.Second}, pool)
+	d.now = func() time.Time { return now }
+	token := func(n string) bson.Raw {
+		b, err := bson.Marshal(bson.M{"n": n})
+		require.NoError(t, err)
+		return b
+	}
+
+	d.add(Event{Type: ArticleUpdated, DocumentID: a, ExternalID: 1, Article: &article.Article{Revision: 1}}, token("a1"))
+	d.add(Event{Type: ArticleUpdated, DocumentID: b, ExternalID: 2, Article: &article.Article{Revision: 1}}, token("b1"))
+	d.add(Event{Type: ArticleMediaUpdated, DocumentID: a, ExternalID: 1, Article: &article.Article{Revision: 2}}, token("a2"))
+
+	now = now.Add(999 * time.Millisecond)
+	d.flush()
+	mu.Lock()
+	assert.Empty(t, published, "the window hasn't closed")
+	mu.Unlock()
+
+	// b stays quiet, a keeps changing and only goes out at the max delay
+	for range 3 {
+		now = now.Add(900 * time.Millisecond)
+		d.add(Event{Type: ArticleUpdated, DocumentID: a, ExternalID: 1, Article: &article.Article{Revision: 3}}, token("a3"))
+		d.flush()
+	}
+	pool.stop()
+
+	require.Len(t, published, 2)
+	byID := map[int64]Event{published[0].ExternalID: published[0], published[1].ExternalID: published[1]}
+	assert.Equal(t, ArticleUpdated, byID[1].Type)
+	assert.Equal(t, 3, byID[1].Article.Revision)
+	assert.Equal(t, 1, byID[2].Article.Revision)
+	assert.Equal(t, "a3", saved[len(saved)-1], "checkpointed past every coalesced change")
+}
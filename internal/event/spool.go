@@ -0,0 +1,200 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"cortex-task/internal/spool"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	spoolPublishTimeout = 30 * time.Second // longer than a publish with every confirm retry
+	spoolCheckInterval  = time.Second
+)
+
+// spoolMetrics is served on /debug/vars as events_spool.
+var spoolMetrics = expvar.NewMap("events_spool")
+
+// healthReporter is implemented by publishers that know whether a publish would go through right now,
+// RabbitPublisher is one.
+type healthReporter interface {
+	State() ConnState
+}
+
+// SpoolingPublisher writes the events its publisher can't take to a spool on disk instead of dropping them,
+// and Run publishes them again in order once the publisher is healthy. While the spool isn't empty new events
+// go to the back of it too, so nothing overtakes an older event.
+//
+// Publishes run in parallel, the event source's workers already keep the events of one article in order and
+// hand them over one at a time.
+type SpoolingPublisher struct {
+	publisher Publisher
+	spool     *spool.Spool
+	timeout   time.Duration
+	wake      chan struct{}
+	logger    *log.Logger
+
+	mu      sync.Mutex // held to check the spool is empty and to append, not while publishing
+	spooled *expvar.Int
+	drained *expvar.Int
+}
+
+func NewSpoolingPublisher(publisher Publisher, sp *spool.Spool, logger *log.Logger) *SpoolingPublisher {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	p := &SpoolingPublisher{
+		publisher: publisher,
+		spool:     sp,
+		timeout:   spoolPublishTimeout,
+		wake:      make(chan struct{}, 1),
+		logger:    logger,
+		spooled:   new(expvar.Int),
+		drained:   new(expvar.Int),
+	}
+
+	spoolMetrics.Set("depth", expvar.Func(func() any { return sp.Len() }))
+	spoolMetrics.Set("bytes", expvar.Func(func() any { return sp.Size() }))
+	spoolMetrics.Set("spooled", p.spooled)
+	spoolMetrics.Set("drained", p.drained)
+
+	return p
+}
+
+// Publish hands e to the publisher when the spool is empty and the publisher is healthy, and spools it when
+// that fails. An error means e is neither published nor spooled, the spool is full or can't be written.
+func (p *SpoolingPublisher) Publish(ctx context.Context, e Event) error {
+	if p.direct() {
+		pubCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		err := p.publisher.Publish(pubCtx, e)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// shutting down, the event source hasn't checkpointed it and delivers it again
+			return err
+		}
+		p.logger.Printf("events: publishing %s for %d failed, spooling it: %v", e.Type, e.ExternalID, err)
+	}
+
+	rec, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.spool.Append(rec); err != nil {
+		if errors.Is(err, spool.ErrFull) {
+			p.logger.Printf("events: spool full (%d events, %d bytes), %s for %d will be retried",
+				p.spool.Len(), p.spool.Size(), e.Type, e.ExternalID)
+		}
+		return err
+	}
+	p.spooled.Add(1)
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// direct reports whether an event can skip the spool, it's empty and the publisher is healthy.
+func (p *SpoolingPublisher) direct() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spool.Len() == 0 && p.healthy()
+}
+
+// Run drains the spool whenever it has events and the publisher is healthy, until ctx is cancelled.
+func (p *SpoolingPublisher) Run(ctx context.Context) {
+	t := time.NewTicker(spoolCheckInterval)
+	defer t.Stop()
+
+	if n := p.spool.Len(); n > 0 {
+		p.logger.Printf("events: %d spooled events waiting to be published", n)
+	}
+
+	for {
+		p.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// drain publishes spooled events oldest first, an event that fails is retried with backoff and holds back
+// everything after it.
+func (p *SpoolingPublisher) drain(ctx context.Context) {
+	n, attempts := 0, 0
+	for p.spool.Len() > 0 && p.healthy() && ctx.Err() == nil {
+		if err := p.drainOne(ctx); err != nil {
+			attempts++
+			p.logger.Printf("events: publishing spooled event failed (attempt %d): %v", attempts, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(relayBackoff(attempts)):
+			}
+			continue
+		}
+		n, attempts = n+1, 0
+	}
+	if n > 0 {
+		p.logger.Printf("events: published %d spooled events, %d left", n, p.spool.Len())
+	}
+}
+
+func (p *SpoolingPublisher) drainOne(ctx context.Context) error {
+	rec, err := p.spool.Peek()
+	if err != nil {
+		return err
+	}
+
+	e, err := decodeSpooled(rec)
+	if err != nil {
+		// it'll never decode, retrying would block the spool for good
+		p.logger.Printf("events: dropping unreadable spooled event: %v", err)
+		return p.spool.Ack()
+	}
+
+	pubCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	if err := p.publisher.Publish(pubCtx, e); err != nil {
+		return err
+	}
+	p.drained.Add(1)
+	return p.spool.Ack()
+}
+
+// decodeSpooled reads back an event written to a spool as JSON.
+func decodeSpooled(rec []byte) (Event, error) {
+	var e Event
+	dec := json.NewDecoder(bytes.NewReader(rec))
+	dec.UseNumber() // keeps the numbers in Changes and Updated as they were
+	err := dec.Decode(&e)
+	return e, err
+}
+
+// Depth is the number of events waiting in the spool.
+func (p *SpoolingPublisher) Depth() int {
+	return p.spool.Len()
+}
+
+func (p *SpoolingPublisher) healthy() bool {
+	if hr, ok := p.publisher.(healthReporter); ok {
+		return hr.State() == StateConnected
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout = 5 * time.Second
+	webhookDisableAfter   = 5                // deliveries failed in a row before an endpoint is disabled
+	webhookDisableFor     = 10 * time.Minute // then one delivery is tried again
+)
+
+// Headers of every webhook request, the signature is over the timestamp, a dot and the body.
+const (
+	WebhookSignatureHeader = "X-Signature-256"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventIDHeader   = "X-Event-Id"
+	WebhookEventTypeHeader = "X-Event-Type"
+)
+
+// ErrWebhookDisabled is returned by a publish while the endpoint is disabled, the event didn't reach it.
+var ErrWebhookDisabled = errors.New("event: webhook endpoint disabled")
+
+// errWebhookRejected is a status retrying won't change, the event is dead-lettered instead.
+var errWebhookRejected = errors.New("rejected")
+
+// WebhookEndpoint is a URL events are POSTed to, requests are signed with Secret and given Timeout each.
+type WebhookEndpoint struct {
+	URL     string
+	Secret  string
+	Timeout time.Duration // defaults to 5s
+}
+
+type webhookEndpoint struct {
+	WebhookEndpoint
+
+	mu            sync.Mutex
+	failures      int // deliveries failed in a row
+	disabledUntil time.Time
+}
+
+// WebhookPublisher POSTs every event to one endpoint, in the newest schema version of the message format. Each
+// endpoint gets a publisher, and a sink, of its own so one that's down doesn't hold up or duplicate the
+// deliveries to the others. A request that fails with a network error, a timeout, a 429 or a 5xx is retried
+// with backoff, and an endpoint that keeps failing is disabled for a while. Any other status is final, the
+// event goes to the dead letter publisher.
+type WebhookPublisher struct {
+	client     *http.Client
+	endpoint   *webhookEndpoint
+	format     MessageFormat
+	deadLetter Publisher // optional, rejected events are only logged without one
+	retryDelay time.Duration
+	now        func() time.Time
+	logger     *log.Logger
+}
+
+func NewWebhookPublisher(endpoint WebhookEndpoint, format MessageFormat, deadLetter Publisher, logger *log.Logger) *WebhookPublisher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if endpoint.Timeout <= 0 {
+		endpoint.Timeout = defaultWebhookTimeout
+	}
+
+	return &WebhookPublisher{
+		client:     &http.Client{},
+		endpoint:   &webhookEndpoint{WebhookEndpoint: endpoint},
+		format:     format,
+		deadLetter: deadLetter,
+		retryDelay: publishRetryDelay,
+		now:        time.Now,
+		logger:     logger,
+	}
+}
+
+// Publish delivers e to the endpoint, or fails with ErrWebhookDisabled without a request while it's disabled.
+// An event the endpoint rejects is dead-lettered and the publish succeeds, it would be rejected again.
+func (p *WebhookPublisher) Publish(ctx context.Context, e Event) error {
+	ep := p.endpoint
+	now := p.now().UTC()
+
+	body, contentType, err := newestMessageBody(e, p.format, now)
+	if err != nil {
+		return err
+	}
+
+	if !ep.enabled(now) {
+		return fmt.Errorf("webhook %s: %w", ep.URL, ErrWebhookDisabled)
+	}
+	err = p.deliver(ctx, ep, e, body, contentType)
+	if errors.Is(err, errWebhookRejected) {
+		// the endpoint answered, it's not failing
+		ep.succeeded()
+		return p.deadLetterEvent(ctx, e, err)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failures, disabled := ep.failed(p.now()); disabled {
+			p.logger.Printf("events: webhook %s failed %d deliveries in a row, disabled for %v",
+				ep.URL, failures, webhookDisableFor)
+		}
+		return fmt.Errorf("webhook %s: %w", ep.URL, err)
+	}
+	ep.succeeded()
+	return nil
+}
+
+// deadLetterEvent keeps an event the endpoint rejected, a failure to keep it fails the publish so it's retried.
+func (p *WebhookPublisher) deadLetterEvent(ctx context.Context, e Event, cause error) error {
+	p.logger.Printf("events: webhook %s rejected %s for %d, dead-lettered: %v", p.endpoint.URL, e.Type, e.ExternalID, cause)
+	if p.deadLetter == nil {
+		return nil
+	}
+	if err := p.deadLetter.Publish(ctx, e); err != nil {
+		return fmt.Errorf("webhook %s: dead-lettering rejected event: %w", p.endpoint.URL, err)
+	}
+	return nil
+}
+
+// deliver retries the request with backoff while the endpoint fails in a way that might go away.
+func (p *WebhookPublisher) deliver(ctx context.Context, ep *webhookEndpoint, e Event, body []byte, contentType string) error {
+	delay := p.retryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := p.post(ctx, ep, e, body, contentType)
+		if err == nil || !retry || attempt == maxPublishAttempts {
+			return err
+		}
+
+		p.logger.Printf("events: webhook %s failed (attempt %d), retrying in %v: %v", ep.URL, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends one signed request and reports whether a failure is worth retrying.
+func (p *WebhookPublisher) post(ctx context.Context, ep *webhookEndpoint, e Event, body []byte, contentType string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ep.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(p.now().Unix(), 10)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(ep.Secret, timestamp, body))
+	req.Header.Set(WebhookEventIDHeader, eventID(e))
+	req.Header.Set(WebhookEventTypeHeader, string(e.Type))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, fmt.Errorf("%w with status %s", errWebhookRejected, resp.Status)
+}
+
+// SignWebhook is the hex HMAC-SHA256 of timestamp + "." + body, receivers compute the same to check a request
+// and reject old timestamps to stop replays.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// enabled is false while the endpoint is disabled, once that's over it gets one delivery to prove itself.
+func (ep *webhookEndpoint) enabled(now time.Time) bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return !now.Before(ep.disabledUntil)
+}
+
+// failed records a failed delivery and reports whether the endpoint got disabled by it.
+func (ep *webhookEndpoint) failed(now time.Time) (int, bool) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	ep.failures++
+	if ep.failures < webhookDisableAfter {
+		return ep.failures, false
+	}
+	ep.disabledUntil = now.Add(webhookDisableFor)
+	return ep.failures, true
+}
+
+func (ep *webhookEndpoint) succeeded() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.failures = 0
+	ep.disabledUntil = time.Time{}
+}
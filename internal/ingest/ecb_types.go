@@ -24,9 +24,15 @@ type ECBArticle struct {
 	LastModified int64        `json:"lastModified"`
 	Body         string       `json:"body"`
 	Summary      string       `json:"summary"`
+	Tags         []ECBTag     `json:"tags"`
 	LeadMedia    ECBLeadMedia `json:"leadMedia"`
 }
 
+type ECBTag struct {
+	ID    int64  `json:"id"`
+	Label string `json:"label"`
+}
+
 type ECBLeadMedia struct {
 	ID           int64  `json:"id"`
 	Type         string `json:"type"`
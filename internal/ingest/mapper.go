@@ -19,6 +19,7 @@ func MapECBToArticle(e ECBArticle) (article.Article, error) {
 		LastModified: parseUnixTime(e.LastModified),
 		Body:         e.Body,
 		Summary:      e.Summary,
+		Tags:         mapTags(e.Tags),
 		LeadMedia: article.LeadMedia{
 			ID:           e.LeadMedia.ID,
 			Type:         e.LeadMedia.Type,
@@ -31,6 +32,17 @@ func MapECBToArticle(e ECBArticle) (article.Article, error) {
 	}, nil
 }
 
+func mapTags(tags []ECBTag) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	labels := make([]string, 0, len(tags))
+	for _, t := range tags {
+		labels = append(labels, t.Label)
+	}
+	return labels
+}
+
 // parseDate example "2025-12-01T09:15:00Z"
 func parseDate(value string) time.Time {
 	if value == "" {
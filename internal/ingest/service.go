@@ -3,12 +3,20 @@ package ingest
 import (
 	"context"
 	"cortex-task/internal/article"
+	"fmt"
 	"log"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const AbsoluteMaxPages = 5000 // absolute max amount of pages we can ingest
 
+const (
+	maxUpsertAttempts = 3                      // how many times we try to write an article before quarantining it
+	upsertRetryDelay  = 200 * time.Millisecond // multiplied by the attempt number between retries
+)
+
 type FeedClient interface {
 	FetchPage(ctx context.Context, page, pageSize int) (ECBResponse, error)
 }
@@ -35,27 +43,29 @@ func (t *timeTicker) Stop() {
 }
 
 type Service struct {
-	repo      article.Repository
-	client    FeedClient
-	pageSize  int
-	maxPages  int
-	maxPolls  int
-	logger    *log.Logger
-	newTicker tickerFactory
+	repo       article.Repository
+	quarantine article.Quarantine
+	client     FeedClient
+	pageSize   int
+	maxPages   int
+	maxPolls   int
+	logger     *log.Logger
+	newTicker  tickerFactory
 }
 
-func NewService(repo article.Repository, client FeedClient, pageSize, maxPages, maxPolls int, logger *log.Logger) *Service {
+func NewService(repo article.Repository, quarantine article.Quarantine, client FeedClient, pageSize, maxPages, maxPolls int, logger *log.Logger) *Service {
 	if logger == nil {
 		logger = log.Default()
 	}
 
 	return &Service{
-		repo:     repo,
-		client:   client,
-		pageSize: pageSize,
-		maxPages: maxPages,
-		maxPolls: maxPolls,
-		logger:   logger,
+		repo:       repo,
+		quarantine: quarantine,
+		client:     client,
+		pageSize:   pageSize,
+		maxPages:   maxPages,
+		maxPolls:   maxPolls,
+		logger:     logger,
 		newTicker: func(d time.Duration) ticker {
 			return &timeTicker{time.NewTicker(d)}
 		},
@@ -67,6 +77,11 @@ func (s *Service) RunOnce(ctx context.Context) error {
 	emptyCount := 0                  // how many times we've seen an empty page (in a row)
 	seen := make(map[int64]struct{}) // prevent writing articles twice in event of data overlap
 
+	// tag every write in this run so revisions can be traced back to it
+	runID := primitive.NewObjectID().Hex()
+	ctx = article.WithRunID(ctx, runID)
+	s.logger.Printf("ingest run %s starting", runID)
+
 	for {
 		resp, err := s.client.FetchPage(ctx, page, s.pageSize)
 		if err != nil {
@@ -102,11 +117,8 @@ func (s *Service) RunOnce(ctx context.Context) error {
 		}
 
 		if len(batch) > 0 {
-			changed, err := s.repo.BulkUpsert(ctx, batch)
-			if err != nil {
-				s.logger.Printf("bulk upsert failed on page %d: %v", page, err)
-			} else {
-				s.logger.Printf("bulk upsert: %d documents changed on page %d", changed, page)
+			if err := s.upsertPage(ctx, page, batch); err != nil {
+				return err
 			}
 		}
 
@@ -129,6 +141,73 @@ func (s *Service) RunOnce(ctx context.Context) error {
 	}
 }
 
+// upsertPage writes a page of articles, retrying the ones that failed and quarantining any that the
+// repository still reports as failed after maxUpsertAttempts. When the whole write keeps failing (the database
+// is unreachable, a timeout) the articles aren't at fault, so nothing is quarantined and the error stops the run
+// for the next poll to try again.
+func (s *Service) upsertPage(ctx context.Context, page int, batch []*article.Article) error {
+	reasons := make(map[int64]string, len(batch))
+
+	var batchErr error
+	for attempt := 1; attempt <= maxUpsertAttempts && len(batch) > 0; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * upsertRetryDelay):
+			}
+			s.logger.Printf("bulk upsert: retrying %d articles on page %d (attempt %d)", len(batch), page, attempt)
+		}
+
+		res, err := s.repo.BulkUpsert(ctx, batch)
+		if err != nil {
+			// the whole batch failed, retry all of it
+			s.logger.Printf("bulk upsert failed on page %d: %v", page, err)
+			batchErr = err
+			continue
+		}
+		batchErr = nil
+
+		s.logger.Printf("bulk upsert: %d inserted, %d updated, %d stale, %d failed on page %d",
+			len(res.Inserted), len(res.Updated), len(res.Stale), len(res.Failed), page)
+
+		failed := make(map[int64]struct{}, len(res.Failed))
+		for _, f := range res.Failed {
+			failed[f.ExternalID] = struct{}{}
+			reasons[f.ExternalID] = f.Reason
+		}
+
+		retry := batch[:0:0]
+		for _, a := range batch {
+			if _, ok := failed[a.ExternalID]; ok {
+				retry = append(retry, a)
+			}
+		}
+		batch = retry
+	}
+
+	if batchErr != nil {
+		return fmt.Errorf("bulk upsert on page %d: %w", page, batchErr)
+	}
+	for _, a := range batch {
+		s.quarantineArticle(ctx, a, reasons[a.ExternalID])
+	}
+	return nil
+}
+
+func (s *Service) quarantineArticle(ctx context.Context, a *article.Article, reason string) {
+	if s.quarantine == nil {
+		s.logger.Printf("giving up on article %d after %d attempts: %s", a.ExternalID, maxUpsertAttempts, reason)
+		return
+	}
+
+	if err := s.quarantine.Quarantine(ctx, a, reason); err != nil {
+		s.logger.Printf("failed to quarantine article %d: %v", a.ExternalID, err)
+		return
+	}
+	s.logger.Printf("quarantined article %d after %d attempts: %s", a.ExternalID, maxUpsertAttempts, reason)
+}
+
 func (s *Service) StartPolling(ctx context.Context, interval time.Duration) {
 	t := s.newTicker(interval)
 	defer t.Stop()
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"cortex-task/internal/article"
+	"cortex-task/internal/article/articletest"
 	"errors"
 	"log"
 	"sync"
@@ -18,13 +19,13 @@ import (
 // Mocks
 // -------------------------
 
-type mockArticleRepo struct {
+type mockQuarantine struct {
 	mock.Mock
 }
 
-func (m *mockArticleRepo) BulkUpsert(ctx context.Context, articles []*article.Article) (int, error) {
-	args := m.Called(ctx, articles)
-	return args.Int(0), args.Error(1)
+func (m *mockQuarantine) Quarantine(ctx context.Context, a *article.Article, reason string) error {
+	args := m.Called(ctx, a, reason)
+	return args.Error(0)
 }
 
 type mockFeedClient struct {
@@ -50,8 +51,9 @@ func (f *fakeTicker) Stop()               {}
 type ServiceSuite struct {
 	suite.Suite
 
-	repo   *mockArticleRepo
-	client *mockFeedClient
+	repo       *articletest.Repository
+	quarantine *mockQuarantine
+	client     *mockFeedClient
 
 	logBuf *bytes.Buffer
 	logger *log.Logger
@@ -64,14 +66,15 @@ func TestServiceSuite(t *testing.T) {
 }
 
 func (s *ServiceSuite) SetupTest() {
-	s.repo = &mockArticleRepo{}
+	s.repo = &articletest.Repository{}
+	s.quarantine = &mockQuarantine{}
 	s.client = &mockFeedClient{}
 
 	s.logBuf = &bytes.Buffer{}
 	s.logger = log.New(s.logBuf, "", 0)
 
 	// Default: no maxPages, no maxPolls
-	s.svc = NewService(s.repo, s.client, 10, -1, 0, s.logger)
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, -1, 0, s.logger)
 }
 
 // emptyResponse returns an empty page but with a non-zero NumPages so the
@@ -120,12 +123,12 @@ func (s *ServiceSuite) TestRunOnce_StopsAfterThreeEmptyPages() {
 	s.Contains(s.logBuf.String(), "no content for 3 pages")
 }
 
-// TestRunOnce_ContinueOnError ensure RunOnce itself doesn't fail when upsert
-// returns an error. We limit maxPages to 1 so the service only ever fetches
-// page 0, matching our single FetchPage expectation.
-func (s *ServiceSuite) TestRunOnce_ContinueOnError() {
+// TestRunOnce_StopsOnBatchError ensure a batch that keeps failing as a whole is retried
+// and then stops the run, without quarantining articles that aren't at fault. We limit
+// maxPages to 1 so the service only ever fetches page 0, matching our single FetchPage expectation.
+func (s *ServiceSuite) TestRunOnce_StopsOnBatchError() {
 	// Override service with maxPages = 1 so only page 0 is ever fetched.
-	s.svc = NewService(s.repo, s.client, 10, 1, 0, s.logger)
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, 1, 0, s.logger)
 
 	resp := nonEmptyResponse(5)
 
@@ -136,22 +139,50 @@ func (s *ServiceSuite) TestRunOnce_ContinueOnError() {
 
 	s.repo.
 		On("BulkUpsert", mock.Anything, mock.AnythingOfType("[]*article.Article")).
-		Return(0, errors.New("db down")).
-		Once()
+		Return(article.UpsertResult{}, errors.New("db down")).
+		Times(maxUpsertAttempts)
 
 	err := s.svc.RunOnce(context.Background())
 
-	s.NoError(err)
+	s.ErrorContains(err, "db down")
 	s.client.AssertExpectations(s.T())
 	s.repo.AssertExpectations(s.T())
+	s.quarantine.AssertNotCalled(s.T(), "Quarantine", mock.Anything, mock.Anything, mock.Anything)
 
 	s.Contains(s.logBuf.String(), "bulk upsert failed on page 0")
 }
 
+// TestRunOnce_QuarantinesRepeatedFailures an article the repository keeps reporting as
+// failed is quarantined with its reason, the run carries on.
+func (s *ServiceSuite) TestRunOnce_QuarantinesRepeatedFailures() {
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, 1, 0, s.logger)
+
+	resp := nonEmptyResponse(5)
+
+	s.client.On("FetchPage", mock.Anything, 0, 10).Return(resp, nil).Once()
+
+	s.repo.
+		On("BulkUpsert", mock.Anything, mock.AnythingOfType("[]*article.Article")).
+		Return(article.UpsertResult{Failed: []article.UpsertFailure{{ExternalID: 123, Reason: "code 121: validation"}}}, nil).
+		Times(maxUpsertAttempts)
+
+	s.quarantine.
+		On("Quarantine", mock.Anything, mock.MatchedBy(func(a *article.Article) bool { return a.ExternalID == 123 }), "code 121: validation").
+		Return(nil).
+		Once()
+
+	err := s.svc.RunOnce(context.Background())
+
+	s.NoError(err)
+	s.repo.AssertExpectations(s.T())
+	s.quarantine.AssertExpectations(s.T())
+	s.Contains(s.logBuf.String(), "quarantined article 123")
+}
+
 // TestRunOnce_MaxPages ensure maxPages config behaviour is correct
 func (s *ServiceSuite) TestRunOnce_MaxPages() {
 	// Override service with a maxPages of 2
-	s.svc = NewService(s.repo, s.client, 10, 2, 0, s.logger)
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, 2, 0, s.logger)
 
 	// Expect FetchPage for page 0 and 1 only.
 	resp0 := ECBResponse{
@@ -180,7 +211,7 @@ func (s *ServiceSuite) TestRunOnce_MaxPages() {
 	// RunOnce should upsert each non-empty page, so expect exactly two calls.
 	s.repo.
 		On("BulkUpsert", mock.Anything, mock.AnythingOfType("[]*article.Article")).
-		Return(1, nil).
+		Return(article.UpsertResult{Inserted: []int64{1}}, nil).
 		Times(2)
 
 	err := s.svc.RunOnce(context.Background())
@@ -203,7 +234,7 @@ func (s *ServiceSuite) TestRunOnce_NumPages() {
 
 	s.repo.
 		On("BulkUpsert", mock.Anything, mock.AnythingOfType("[]*article.Article")).
-		Return(1, nil).
+		Return(article.UpsertResult{Inserted: []int64{1}}, nil).
 		Once()
 
 	err := s.svc.RunOnce(context.Background())
@@ -220,7 +251,7 @@ func (s *ServiceSuite) TestStartPolling_StopsAfterMaxPolls() {
 	maxPolls := 2
 
 	// fresh service with maxPolls set
-	s.svc = NewService(s.repo, s.client, 10, 1, maxPolls, s.logger)
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, 1, maxPolls, s.logger)
 
 	// inject fake ticker
 	tickCh := make(chan time.Time)
@@ -239,7 +270,7 @@ func (s *ServiceSuite) TestStartPolling_StopsAfterMaxPolls() {
 
 	s.repo.
 		On("BulkUpsert", mock.Anything, mock.AnythingOfType("[]*article.Article")).
-		Return(1, nil).
+		Return(article.UpsertResult{Inserted: []int64{1}}, nil).
 		Times(maxPolls)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -267,3 +298,66 @@ func (s *ServiceSuite) TestStartPolling_StopsAfterMaxPolls() {
 	s.repo.AssertExpectations(s.T())
 	s.Contains(s.logBuf.String(), "poller stopping after 2 polls")
 }
+
+// TestRunOnce_RetriesOnlyFailedArticles articles that failed are retried on their own,
+// the ones that were written are not sent again.
+func (s *ServiceSuite) TestRunOnce_RetriesOnlyFailedArticles() {
+	s.svc = NewService(s.repo, s.quarantine, s.client, 10, 1, 0, s.logger)
+
+	resp := ECBResponse{Content: []ECBArticle{{ID: 1}, {ID: 2}}}
+	resp.PageInfo.NumPages = 5
+
+	s.client.On("FetchPage", mock.Anything, 0, 10).Return(resp, nil).Once()
+
+	s.repo.
+		On("BulkUpsert", mock.Anything, mock.MatchedBy(func(batch []*article.Article) bool { return len(batch) == 2 })).
+		Return(article.UpsertResult{
+			Inserted: []int64{1},
+			Failed:   []article.UpsertFailure{{ExternalID: 2, Reason: "code 121: validation"}},
+		}, nil).
+		Once()
+	s.repo.
+		On("BulkUpsert", mock.Anything, mock.MatchedBy(func(batch []*article.Article) bool {
+			return len(batch) == 1 && batch[0].ExternalID == 2
+		})).
+		Return(article.UpsertResult{Inserted: []int64{2}}, nil).
+		Once()
+
+	err := s.svc.RunOnce(context.Background())
+
+	s.NoError(err)
+	s.repo.AssertExpectations(s.T())
+	s.quarantine.AssertNotCalled(s.T(), "Quarantine", mock.Anything, mock.Anything, mock.Anything)
+	s.Contains(s.logBuf.String(), "retrying 1 articles on page 0 (attempt 2)")
+}
+
+// TestRunOnce_StoresMappedArticles runs against the in-memory repository rather than
+// the mock so we assert on what actually got stored.
+func (s *ServiceSuite) TestRunOnce_StoresMappedArticles() {
+	repo := article.NewMemoryArticleRepository()
+	s.svc = NewService(repo, s.quarantine, s.client, 10, -1, 0, s.logger)
+
+	resp := ECBResponse{Content: []ECBArticle{
+		{ID: 1, Title: "First", LastModified: 1764580500000},
+		{ID: 2, Title: "Second", LastModified: 1764580500000},
+		{ID: 1, Title: "Duplicate", LastModified: 1764580900000},
+	}}
+	resp.PageInfo.NumPages = 1
+
+	s.client.On("FetchPage", mock.Anything, 0, 10).Return(resp, nil).Once()
+
+	s.NoError(s.svc.RunOnce(context.Background()))
+
+	count, err := repo.Count(context.Background(), article.Filter{})
+	s.Require().NoError(err)
+	s.Equal(int64(2), count)
+
+	got, err := repo.GetByExternalID(context.Background(), 1)
+	s.Require().NoError(err)
+	s.Equal("First", got.Title, "duplicates within a run are skipped")
+
+	revisions, err := repo.ListRevisions(context.Background(), 1)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 1)
+	s.NotEmpty(revisions[0].RunID)
+}
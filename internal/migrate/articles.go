@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Articles is the ordered list of migrations for the articles collections. Append new migrations with the
+// next version, never edit or reorder one that has shipped.
+func Articles() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "backfill revision on articles written before revision history",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := Backfill(ctx, db.Collection("articles"),
+					bson.M{"revision": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"revision": 0}},
+					0,
+				)
+				return err
+			},
+		},
+		{
+			Version:     2,
+			Description: "backfill createdAt and modifiedAt where missing",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				col := db.Collection("articles")
+				// pipeline update so the fallback comes from each document's own lastModified
+				for _, field := range []string{"createdAt", "modifiedAt"} {
+					_, err := Backfill(ctx, col,
+						bson.M{field: bson.M{"$exists": false}},
+						mongo.Pipeline{{{Key: "$set", Value: bson.M{field: "$lastModified"}}}},
+						0,
+					)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
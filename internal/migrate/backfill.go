@@ -0,0 +1,59 @@
+package migrate
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultBackfillBatch = 500
+
+// Backfill applies update to every document matching filter in batches of batchSize, ordered by _id. The
+// update must make a document stop matching filter (e.g. filter on the field being missing and $set it),
+// that way an interrupted backfill simply carries on where it stopped when the migration is re-run.
+func Backfill(ctx context.Context, col *mongo.Collection, filter bson.M, update any, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatch
+	}
+
+	var total int64
+	for {
+		cur, err := col.Find(ctx, filter, options.Find().
+			SetProjection(bson.M{"_id": 1}).
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(int64(batchSize)),
+		)
+		if err != nil {
+			return total, err
+		}
+
+		var docs []struct {
+			ID any `bson:"_id"`
+		}
+		if err := cur.All(ctx, &docs); err != nil {
+			return total, err
+		}
+		if len(docs) == 0 {
+			return total, nil
+		}
+
+		ids := make(bson.A, 0, len(docs))
+		for _, d := range docs {
+			ids = append(ids, d.ID)
+		}
+
+		// keep the original filter so documents changed since the read are left alone
+		batch := bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}}
+		res, err := col.UpdateMany(ctx, batch, update)
+		if err != nil {
+			return total, err
+		}
+		total += res.ModifiedCount
+
+		if len(docs) < batchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationsCollection = "schema_migrations"
+	locksCollection      = "schema_locks"
+	lockID               = "migrations"
+
+	defaultLockTTL   = 10 * time.Minute // a crashed replica's lock is taken over after this
+	lockPollInterval = 2 * time.Second
+)
+
+var (
+	// ErrLocked is returned when another process holds the migration lock for longer than ctx allows.
+	ErrLocked = errors.New("migrate: lock held by another process")
+	// ErrLockLost is returned when the lock couldn't be refreshed while a migration ran, it may have expired
+	// and been taken over, so the migration is aborted rather than run alongside another replica.
+	ErrLockLost = errors.New("migrate: lost the migration lock")
+)
+
+// Migration is a single versioned schema change. Up must be safe to re-run if it fails halfway, the version
+// is only recorded once it returns without error.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Applied is the record kept in schema_migrations for every migration that has run.
+type Applied struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+	Duration    string    `bson:"duration"`
+}
+
+type Status struct {
+	Migration
+	Applied *Applied // nil while pending
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+	logger     *log.Logger
+}
+
+func New(db *mongo.Database, migrations []Migration, logger *log.Logger) (*Migrator, error) {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	sorted, err := validate(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+		lockTTL:    defaultLockTTL,
+		logger:     logger,
+	}, nil
+}
+
+// validate returns the migrations ordered by version and rejects duplicate or non-positive versions.
+func validate(migrations []Migration) ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrate: version must be positive, got %d", m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: migration %d has no Up func", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: duplicate version %d", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// pending returns the migrations not in applied, in version order.
+func pending(migrations []Migration, applied map[int]Applied) []Migration {
+	out := make([]Migration, 0)
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Up applies every pending migration in version order while holding the migration lock, so replicas starting
+// at the same time wait for the first one instead of running the same migration twice.
+func (m *Migrator) Up(ctx context.Context) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := m.heartbeat(ctx, cancel)
+	defer stop()
+
+	err := m.up(ctx)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+func (m *Migrator) up(ctx context.Context) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	todo := pending(m.migrations, applied)
+	if len(todo) == 0 {
+		m.logger.Println("migrate: schema up to date")
+		return nil
+	}
+
+	for _, mig := range todo {
+		m.logger.Printf("migrate: applying %d %s", mig.Version, mig.Description)
+		start := time.Now()
+		if err := mig.Up(ctx, m.db); err != nil {
+			return fmt.Errorf("migrate: %d %s failed: %w", mig.Version, mig.Description, err)
+		}
+
+		took := time.Since(start)
+		_, err := m.db.Collection(migrationsCollection).InsertOne(ctx, Applied{
+			Version:     mig.Version,
+			Description: mig.Description,
+			AppliedAt:   time.Now(),
+			Duration:    took.String(),
+		})
+		if err != nil {
+			return fmt.Errorf("migrate: recording %d failed: %w", mig.Version, err)
+		}
+		m.logger.Printf("migrate: applied %d in %v", mig.Version, took)
+	}
+	return nil
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = &a
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]Applied, error) {
+	cur, err := m.db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var records []Applied
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]Applied, len(records))
+	for _, a := range records {
+		applied[a.Version] = a
+	}
+	return applied, nil
+}
+
+// lock takes or refreshes the migration lock, waiting while another owner holds an unexpired one. The lock
+// is a single document, the upsert only matches when the lock is free, expired or already ours, otherwise
+// it collides with the existing _id and fails with a duplicate key error.
+func (m *Migrator) lock(ctx context.Context) error {
+	col := m.db.Collection(locksCollection)
+
+	for {
+		now := time.Now()
+		_, err := col.UpdateOne(ctx,
+			bson.M{
+				"_id": lockID,
+				"$or": bson.A{
+					bson.M{"owner": m.owner},
+					bson.M{"expiresAt": bson.M{"$lt": now}},
+				},
+			},
+			bson.M{"$set": bson.M{"owner": m.owner, "lockedAt": now, "expiresAt": now.Add(m.lockTTL)}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("migrate: taking lock: %w", err)
+		}
+
+		m.logger.Printf("migrate: waiting for lock held by another process")
+		select {
+		case <-ctx.Done():
+			return ErrLocked
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// heartbeat refreshes the lock every third of its TTL until stop is called, so a long migration doesn't
+// outlive it. A failed refresh cancels ctx with ErrLockLost, which aborts the migration that's running.
+func (m *Migrator) heartbeat(ctx context.Context, cancel context.CancelCauseFunc) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(m.lockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			if err := m.refreshLock(ctx); err != nil {
+				m.logger.Printf("migrate: refreshing lock failed, aborting: %v", err)
+				cancel(err)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// refreshLock extends a lock we hold, unlike lock it doesn't wait or take over: if the lock isn't ours
+// anymore it's lost.
+func (m *Migrator) refreshLock(ctx context.Context) error {
+	now := time.Now()
+	res, err := m.db.Collection(locksCollection).UpdateOne(ctx,
+		bson.M{"_id": lockID, "owner": m.owner},
+		bson.M{"$set": bson.M{"lockedAt": now, "expiresAt": now.Add(m.lockTTL)}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLockLost, err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: taken over by another process", ErrLockLost)
+	}
+	return nil
+}
+
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := m.db.Collection(locksCollection).DeleteOne(ctx, bson.M{"_id": lockID, "owner": m.owner}); err != nil {
+		m.logger.Printf("migrate: failed releasing lock: %v", err)
+	}
+}
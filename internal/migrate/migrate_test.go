@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+func TestValidateSortsByVersion(t *testing.T) {
+	sorted, err := validate([]Migration{
+		{Version: 3, Up: noop},
+		{Version: 1, Up: noop},
+		{Version: 2, Up: noop},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, sorted[0].Version)
+	assert.Equal(t, 2, sorted[1].Version)
+	assert.Equal(t, 3, sorted[2].Version)
+}
+
+func TestValidateRejectsBadMigrations(t *testing.T) {
+	_, err := validate([]Migration{{Version: 1, Up: noop}, {Version: 1, Up: noop}})
+	assert.ErrorContains(t, err, "duplicate version 1")
+
+	_, err = validate([]Migration{{Version: 0, Up: noop}})
+	assert.ErrorContains(t, err, "must be positive")
+
+	_, err = validate([]Migration{{Version: 1}})
+	assert.ErrorContains(t, err, "no Up func")
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	todo := pending(migrations, map[int]Applied{1: {Version: 1}, 3: {Version: 3}})
+
+	require.Len(t, todo, 1)
+	assert.Equal(t, 2, todo[0].Version)
+}
+
+func TestArticleMigrationsAreValid(t *testing.T) {
+	_, err := validate(Articles())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,229 @@
+package retention
+
+import (
+	"context"
+	"cortex-task/internal/article"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ModeArchive = "archive" // copy into articles_archive, then delete
+	ModeDelete  = "delete"
+
+	defaultBatchSize = 500
+
+	// RetainField marks an article that's never swept, set it with {$set: {retain: true}}. It isn't part of the
+	// ingested article so ingestion doesn't touch it.
+	RetainField = "retain"
+)
+
+// Policy decides which articles are old enough to leave the articles collection.
+type Policy struct {
+	MaxAge    time.Duration // articles whose Field is older than this are swept, 0 disables retention
+	Field     string        // "date" or "lastModified"
+	Mode      string        // ModeArchive or ModeDelete
+	BatchSize int
+}
+
+func (p Policy) Validate() error {
+	if p.MaxAge < 0 {
+		return fmt.Errorf("retention: max age must not be negative, got %v", p.MaxAge)
+	}
+	if p.Field != "date" && p.Field != "lastModified" {
+		return fmt.Errorf("retention: unsupported field %q, expected date or lastModified", p.Field)
+	}
+	if p.Mode != ModeArchive && p.Mode != ModeDelete {
+		return fmt.Errorf("retention: unsupported mode %q, expected %s or %s", p.Mode, ModeArchive, ModeDelete)
+	}
+	return nil
+}
+
+// filter matches the articles due for removal at now. articles marked with RetainField are always kept, tags
+// don't exempt anything since nearly every article has the feed's labels as tags.
+func (p Policy) filter(now time.Time) bson.M {
+	return bson.M{
+		p.Field:     bson.M{"$lt": now.Add(-p.MaxAge)},
+		RetainField: bson.M{"$ne": true},
+	}
+}
+
+// Result is what a single sweep did.
+type Result struct {
+	Archived int64
+	Deleted  int64
+	Batches  int
+}
+
+type Job struct {
+	articles *mongo.Collection
+	archive  *mongo.Collection
+	swept    *mongo.Collection
+	policy   Policy
+	logger   *log.Logger
+}
+
+func NewJob(db *mongo.Database, policy Policy, logger *log.Logger) (*Job, error) {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = defaultBatchSize
+	}
+
+	return &Job{
+		articles: db.Collection("articles"),
+		archive:  db.Collection("articles_archive"),
+		swept:    db.Collection(article.SweptCollection),
+		policy:   policy,
+		logger:   logger,
+	}, nil
+}
+
+// RunOnce sweeps every expired article, oldest first, one batch at a time. each batch is archived before it
+// is deleted and the archive write is an upsert by _id, so a sweep interrupted at any point is picked up
+// by the next one without losing or duplicating documents.
+func (j *Job) RunOnce(ctx context.Context) (Result, error) {
+	var res Result
+	if j.policy.MaxAge == 0 {
+		return res, nil
+	}
+
+	filter := j.policy.filter(time.Now())
+	opts := options.Find().
+		SetSort(bson.D{{Key: j.policy.Field, Value: 1}}).
+		SetLimit(int64(j.policy.BatchSize))
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		cur, err := j.articles.Find(ctx, filter, opts)
+		if err != nil {
+			return res, err
+		}
+		var docs []bson.M
+		if err := cur.All(ctx, &docs); err != nil {
+			return res, err
+		}
+		if len(docs) == 0 {
+			return res, nil
+		}
+
+		ids := make(bson.A, 0, len(docs))
+		for _, d := range docs {
+			ids = append(ids, d["_id"])
+		}
+
+		if j.policy.Mode == ModeArchive {
+			archived, err := j.archiveBatch(ctx, docs)
+			if err != nil {
+				return res, err
+			}
+			res.Archived += archived
+		}
+
+		// recorded first so ingest doesn't bring the articles back, a record for one that stays below is harmless,
+		// ingest only looks at it for articles it can't find
+		if err := j.recordSwept(ctx, docs); err != nil {
+			return res, err
+		}
+
+		// re-check the filter so an article refreshed since the read stays where it is
+		del, err := j.articles.DeleteMany(ctx, bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}})
+		if err != nil {
+			return res, err
+		}
+		res.Deleted += del.DeletedCount
+		res.Batches++
+
+		if len(docs) < j.policy.BatchSize {
+			return res, nil
+		}
+	}
+}
+
+func (j *Job) archiveBatch(ctx context.Context, docs []bson.M) (int64, error) {
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(docs))
+	for _, d := range docs {
+		d["archivedAt"] = now
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": d["_id"]}).
+			SetReplacement(d).
+			SetUpsert(true),
+		)
+	}
+
+	res, err := j.archive.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	return res.UpsertedCount + res.ModifiedCount, nil
+}
+
+// recordSwept writes an article.Swept record for every doc.
+func (j *Job) recordSwept(ctx context.Context, docs []bson.M) error {
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(docs))
+	for _, d := range docs {
+		if d["externalId"] == nil {
+			continue
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": d["externalId"]}).
+			SetReplacement(bson.M{"sweptAt": now}).
+			SetUpsert(true),
+		)
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := j.swept.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Start sweeps right away and then on every interval until ctx is cancelled, a failed sweep is logged and
+// retried next time.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	if j.policy.MaxAge == 0 {
+		j.logger.Println("retention: disabled")
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	j.logger.Printf("retention: sweeping articles older than %v by %s every %v (%s)", j.policy.MaxAge, j.policy.Field, interval, j.policy.Mode)
+
+	for {
+		j.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			j.logger.Println("retention: stopping — context cancelled")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j *Job) sweep(ctx context.Context) {
+	res, err := j.RunOnce(ctx)
+	if err != nil {
+		j.logger.Printf("retention: sweep failed after %d batches: %v", res.Batches, err)
+		return
+	}
+	if res.Deleted > 0 {
+		j.logger.Printf("retention: %d archived, %d deleted in %d batches", res.Archived, res.Deleted, res.Batches)
+	}
+}
@@ -0,0 +1,88 @@
+package retention
+
+import (
+	"context"
+	"cortex-task/internal/article"
+	"cortex-task/internal/db"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	valid := Policy{MaxAge: 24 * time.Hour, Field: "date", Mode: ModeArchive}
+	assert.NoError(t, valid.Validate())
+
+	disabled := Policy{Field: "lastModified", Mode: ModeDelete}
+	assert.NoError(t, disabled.Validate())
+
+	assert.Error(t, Policy{MaxAge: -time.Hour, Field: "date", Mode: ModeArchive}.Validate())
+	assert.Error(t, Policy{MaxAge: time.Hour, Field: "title", Mode: ModeArchive}.Validate())
+	assert.Error(t, Policy{MaxAge: time.Hour, Field: "date", Mode: "move"}.Validate())
+}
+
+func TestPolicyFilterExemptsRetainedArticles(t *testing.T) {
+	now := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	p := Policy{MaxAge: 30 * 24 * time.Hour, Field: "lastModified", Mode: ModeDelete}
+
+	assert.Equal(t, bson.M{
+		"lastModified": bson.M{"$lt": time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)},
+		"retain":       bson.M{"$ne": true},
+	}, p.filter(now))
+}
+
+func TestJobRunOnceKeepsOnlyRetainedArticles(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := db.ConnectMongo(ctx, "mongodb://localhost:27017")
+	if err != nil {
+		t.Skipf("retention tests need MongoDB at localhost:27017: %v", err)
+	}
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	database := client.Database("test_newsdb_retention")
+	require.NoError(t, database.Drop(ctx))
+	defer func() { _ = database.Drop(ctx) }()
+
+	old := time.Now().Add(-48 * time.Hour)
+	_, err = database.Collection("articles").InsertMany(ctx, []any{
+		bson.M{"externalId": 1, "date": old},
+		bson.M{"externalId": 2, "date": old, "tags": nil},
+		bson.M{"externalId": 3, "date": old, "tags": bson.A{}},
+		bson.M{"externalId": 4, "date": old, "tags": bson.A{"Cricket"}},
+		bson.M{"externalId": 5, "date": old, "retain": true},
+		bson.M{"externalId": 6, "date": time.Now()},
+	})
+	require.NoError(t, err)
+
+	job, err := NewJob(database, Policy{MaxAge: 24 * time.Hour, Field: "date", Mode: ModeArchive}, nil)
+	require.NoError(t, err)
+
+	res, err := job.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), res.Deleted)
+	assert.Equal(t, int64(4), res.Archived)
+
+	var kept []struct {
+		ExternalID int64 `bson:"externalId"`
+	}
+	cur, err := database.Collection("articles").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"externalId": 1}))
+	require.NoError(t, err)
+	require.NoError(t, cur.All(ctx, &kept))
+	require.Len(t, kept, 2)
+	assert.Equal(t, int64(5), kept[0].ExternalID)
+	assert.Equal(t, int64(6), kept[1].ExternalID)
+
+	// recorded so ingest doesn't insert them again
+	var swept []article.Swept
+	cur, err = database.Collection(article.SweptCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	require.NoError(t, err)
+	require.NoError(t, cur.All(ctx, &swept))
+	require.Len(t, swept, 4)
+	assert.Equal(t, int64(1), swept[0].ExternalID)
+	assert.Equal(t, int64(4), swept[3].ExternalID)
+}
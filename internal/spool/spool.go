@@ -0,0 +1,336 @@
+// Package spool is a durable FIFO queue of byte records kept in append-only segment files in a directory.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSegmentSize = 16 << 20
+
+	headerSize    = 8 // 4 byte length + 4 byte crc32 of the payload
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+)
+
+var (
+	// ErrFull is returned by Append when the record would take the spool over its size limit.
+	ErrFull = errors.New("spool: full")
+	// ErrEmpty is returned by Peek when there is nothing to read.
+	ErrEmpty = errors.New("spool: empty")
+)
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// Spool appends records to the newest segment and reads them back from the oldest, in order. The read
+// position is kept in a cursor file so acknowledged records are not read again after a restart, and a
+// segment is deleted once every record in it has been acknowledged.
+type Spool struct {
+	dir         string
+	maxBytes    int64 // 0 is unlimited
+	segmentSize int64
+
+	mu       sync.Mutex
+	segments []segment // oldest first, the last one is written to
+	writer   *os.File
+	readOff  int64 // offset of the next record in segments[0]
+	count    int   // records not yet acknowledged
+	bytes    int64 // bytes not yet acknowledged, headers included
+}
+
+// Open opens or creates the spool in dir. A record cut short by a crash at the end of the newest segment is
+// dropped.
+func Open(dir string, maxBytes, segmentSize int64) (*Spool, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, segmentSize: segmentSize}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, segment{id: id})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	readID, readOff, err := s.readCursor()
+	if err != nil {
+		return err
+	}
+
+	// drop segments the cursor has already moved past, then count what's left
+	for len(s.segments) > 0 && s.segments[0].id < readID {
+		if err := os.Remove(s.path(s.segments[0].id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].id == readID {
+		s.readOff = readOff
+	}
+
+	for i := range s.segments {
+		last := i == len(s.segments)-1
+		start := int64(0)
+		if i == 0 {
+			start = s.readOff
+		}
+		size, n, err := s.scan(s.segments[i].id, start, last)
+		if err != nil {
+			return err
+		}
+		s.segments[i].size = size
+		s.count += n
+		s.bytes += size - start
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, segment{id: 1})
+	}
+	return s.openWriter()
+}
+
+// scan counts the records in a segment from start and returns the size of its valid part. a broken record in
+// the newest segment is a write cut short and is truncated, anywhere else it's corruption.
+func (s *Spool) scan(id uint64, start int64, newest bool) (int64, int, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	off, n := start, 0
+	for off < info.Size() {
+		payload, err := readRecord(f, off)
+		if err != nil {
+			if !newest {
+				return 0, 0, fmt.Errorf("spool: segment %d corrupt at %d: %w", id, off, err)
+			}
+			if err := os.Truncate(s.path(id), off); err != nil {
+				return 0, 0, err
+			}
+			return off, n, nil
+		}
+		off += headerSize + int64(len(payload))
+		n++
+	}
+	return off, n, nil
+}
+
+func readRecord(f *os.File, off int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, off+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// Append writes rec to the end of the spool and syncs it to disk.
+func (s *Spool) Append(rec []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := headerSize + int64(len(rec))
+	if s.maxBytes > 0 && s.bytes+size > s.maxBytes {
+		return ErrFull
+	}
+
+	newest := &s.segments[len(s.segments)-1]
+	if newest.size > 0 && newest.size+size > s.segmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+		newest = &s.segments[len(s.segments)-1]
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(rec)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(rec))
+	copy(buf[headerSize:], rec)
+
+	if _, err := s.writer.Write(buf); err != nil {
+		return err
+	}
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+
+	newest.size += size
+	s.count++
+	s.bytes += size
+	return nil
+}
+
+// roll starts a new segment.
+func (s *Spool) roll() error {
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	s.segments = append(s.segments, segment{id: s.segments[len(s.segments)-1].id + 1})
+	return s.openWriter()
+}
+
+func (s *Spool) openWriter() error {
+	f, err := os.OpenFile(s.path(s.segments[len(s.segments)-1].id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.writer = f
+	return nil
+}
+
+// Peek returns the oldest record without removing it, or ErrEmpty.
+func (s *Spool) Peek() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count == 0 {
+		return nil, ErrEmpty
+	}
+
+	f, err := os.Open(s.path(s.segments[0].id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	payload, err := readRecord(f, s.readOff)
+	if err != nil {
+		return nil, fmt.Errorf("spool: reading segment %d at %d: %w", s.segments[0].id, s.readOff, err)
+	}
+	return payload, nil
+}
+
+// Ack removes the record Peek returned.
+func (s *Spool) Ack() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count == 0 {
+		return ErrEmpty
+	}
+
+	f, err := os.Open(s.path(s.segments[0].id))
+	if err != nil {
+		return err
+	}
+	var header [headerSize]byte
+	_, err = f.ReadAt(header[:], s.readOff)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+
+	size := headerSize + int64(binary.BigEndian.Uint32(header[0:4]))
+	s.readOff += size
+	s.count--
+	s.bytes -= size
+
+	// a fully read segment is deleted, unless it's the one being written to
+	if s.readOff >= s.segments[0].size && len(s.segments) > 1 {
+		if err := os.Remove(s.path(s.segments[0].id)); err != nil {
+			return err
+		}
+		s.segments = s.segments[1:]
+		s.readOff = 0
+	}
+	return s.writeCursor()
+}
+
+// Len is the number of records waiting to be read.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Size is the number of bytes on disk used by records waiting to be read.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writer.Close()
+}
+
+func (s *Spool) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// writeCursor replaces the cursor file, written to a temporary file first so a crash never leaves half a cursor.
+func (s *Spool) writeCursor() error {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[0:8], s.segments[0].id)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(s.readOff))
+
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, buf[:], 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, cursorFile))
+}
+
+func (s *Spool) readCursor() (uint64, int64, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(buf) != 16 {
+		return 0, 0, fmt.Errorf("spool: cursor file is %d bytes, expected 16", len(buf))
+	}
+	return binary.BigEndian.Uint64(buf[0:8]), int64(binary.BigEndian.Uint64(buf[8:16])), nil
+}
@@ -0,0 +1,119 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var got []string
+	for {
+		rec, err := s.Peek()
+		if err == ErrEmpty {
+			return got
+		}
+		require.NoError(t, err)
+		got = append(got, string(rec))
+		require.NoError(t, s.Ack())
+	}
+}
+
+func TestSpoolReadsInOrder(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, rec := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Append([]byte(rec)))
+	}
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, int64(3*(headerSize+1)), s.Size())
+
+	assert.Equal(t, []string{"a", "b", "c"}, drain(t, s))
+	assert.Equal(t, 0, s.Len())
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	require.NoError(t, err)
+	for _, rec := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Append([]byte(rec)))
+	}
+	_, err = s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.Ack())
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, 2, s.Len())
+	require.NoError(t, s.Append([]byte("d")))
+	assert.Equal(t, []string{"b", "c", "d"}, drain(t, s))
+}
+
+func TestSpoolRollsAndDeletesSegments(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 2*(headerSize+2))
+	require.NoError(t, err)
+	defer s.Close()
+
+	var want []string
+	for i := range 5 {
+		rec := fmt.Sprintf("%02d", i)
+		want = append(want, rec)
+		require.NoError(t, s.Append([]byte(rec)))
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	assert.Len(t, segments, 3)
+
+	assert.Equal(t, want, drain(t, s))
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	assert.Len(t, segments, 1, "only the segment being written to is kept")
+}
+
+func TestSpoolFull(t *testing.T) {
+	s, err := Open(t.TempDir(), 2*(headerSize+1), 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Append([]byte("a")))
+	require.NoError(t, s.Append([]byte("b")))
+	assert.ErrorIs(t, s.Append([]byte("c")), ErrFull)
+
+	_, err = s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.Ack())
+	assert.NoError(t, s.Append([]byte("c")), "acked records free up space")
+}
+
+func TestSpoolDropsTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Append([]byte("a")))
+	require.NoError(t, s.Close())
+
+	// half a record, as if the process died mid write
+	f, err := os.OpenFile(s.path(1), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 5, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Append([]byte("b")))
+	assert.Equal(t, []string{"a", "b"}, drain(t, s))
+}